@@ -0,0 +1,44 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setCalendar sets a time.Month or time.Weekday field from either its
+// English name, ignoring case, or its number, which is 1 to 12 for
+// months and 0 (Sunday) to 6 for weekdays.
+func setCalendar(v reflect.Value, value string) error {
+	var (
+		kind  string
+		first int
+		names []string
+	)
+	if v.Type() == monthType {
+		kind, first = "month", int(time.January)
+		for m := time.January; m <= time.December; m++ {
+			names = append(names, m.String())
+		}
+	} else {
+		kind, first = "weekday", int(time.Sunday)
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			names = append(names, d.String())
+		}
+	}
+
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			v.SetInt(int64(first + i))
+			return nil
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= first && n < first+len(names) {
+		v.SetInt(int64(n))
+		return nil
+	}
+
+	return fmt.Errorf("%q is not a %s: expected one of %s or %d-%d", value, kind, strings.Join(names, ", "), first, first+len(names)-1)
+}
@@ -0,0 +1,154 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// isNumeric returns true if the field, or the elements of the field
+// if it is a slice, are integers or floats whose choices should be
+// compared numerically rather than textually.
+func isNumeric(t reflect.StructField) bool {
+	ft := t.Type
+	if ft.Kind() == reflect.Slice {
+		ft = ft.Elem()
+	}
+	if ft == durationType || isCalendar(ft) {
+		return false
+	}
+	if _, ok := lookupEnum(ft); ok {
+		return false
+	}
+
+	switch ft.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isCalendar returns true for time.Month and time.Weekday, which are
+// set by name or by number.
+func isCalendar(t reflect.Type) bool {
+	return t == monthType || t == weekdayType
+}
+
+// hasParsedChoices returns true if the choices of the field should be
+// compared by parsed value rather than textually, as per
+// checkNumericChoice.
+func hasParsedChoices(t reflect.StructField) bool {
+	ft := t.Type
+	if ft.Kind() == reflect.Slice {
+		ft = ft.Elem()
+	}
+	return isNumeric(t) || isCalendar(ft)
+}
+
+// checkNumericChoice parses the choices and each of the values using
+// the field's type, returning an error if any value isn't equal to
+// one of the choices.  This means that "1024" and "1024.0" are
+// equivalent for a float field, as are "1024", "01024" and "0x400"
+// for an integer field, and "January" and "1" for a time.Month field.
+// Integers are decimal unless they have an explicit 0x, 0o or 0b
+// prefix.  The values are returned as parsed, so that they can be
+// assigned to the field without being interpreted differently.
+func checkNumericChoice(t reflect.StructField, choices string, values string, o *options) (string, error) {
+	et := t.Type
+	if et.Kind() == reflect.Slice {
+		et = et.Elem()
+	}
+	delimiter := getDelimiter(t, o)
+
+	parse, noun := setChoice, "numbers"
+	if isCalendar(et) {
+		parse, noun = setCalendar, "values"
+	}
+
+	rawChoices := split(choices, delimiter)
+	allowed := make([]interface{}, len(rawChoices))
+	for i, choice := range rawChoices {
+		cv := reflect.New(et).Elem()
+		if err := parse(cv, choice); err != nil {
+			return "", fmt.Errorf("choice %q is not a valid %v", choice, et)
+		}
+		allowed[i] = cv.Interface()
+	}
+
+	var parsed []string
+	for _, value := range split(values, delimiter) {
+		vv := reflect.New(et).Elem()
+		if err := parse(vv, value); err != nil || !containsValue(allowed, vv.Interface()) {
+			return "", fmt.Errorf("not one of the allowed %s %s", noun, strings.Join(rawChoices, ", "))
+		}
+		parsed = append(parsed, formatNumber(vv))
+	}
+	return strings.Join(parsed, delimiter), nil
+}
+
+// setChoice sets a numeric value as per setBuiltInField, except that
+// integers are parsed as decimal unless they have an explicit 0x, 0o
+// or 0b prefix, so a leading zero doesn't make a choice octal.
+func setChoice(v reflect.Value, value string) error {
+	var unsigned bool
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		unsigned = true
+	default:
+		return setBuiltInField(v, value)
+	}
+
+	sign, digits := "", value
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+
+	if unsigned {
+		if sign == "-" {
+			return fmt.Errorf("%q is negative", value)
+		}
+		u, err := strconv.ParseUint(digits, base, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+		return nil
+	}
+
+	i, err := strconv.ParseInt(sign+digits, base, v.Type().Bits())
+	if err != nil {
+		return err
+	}
+	v.SetInt(i)
+	return nil
+}
+
+// formatNumber formats an integer or float in decimal, ignoring any
+// String method of its type.
+func formatNumber(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	}
+	return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+}
@@ -0,0 +1,226 @@
+package env
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// constraints are the named numeric predicates that can be used in
+// a field's "constraint" tag.  Integers are tested exactly, while
+// floats are only even, odd or a power of 2 if they are integral.
+var constraints = map[string]func(number) bool{
+	"pow2": func(n number) bool {
+		if n.isFloat {
+			return n.f >= 1 && isInteger(n.f) && n.f <= math.MaxUint64 && isPow2(uint64(n.f))
+		}
+		return !n.negative && n.mag >= 1 && isPow2(n.mag)
+	},
+	"positive": func(n number) bool { return n.compare(number{}) > 0 },
+	"nonneg":   func(n number) bool { return n.compare(number{}) >= 0 },
+	"even": func(n number) bool {
+		if n.isFloat {
+			return isInteger(n.f) && math.Mod(n.f, 2) == 0
+		}
+		return n.mag%2 == 0
+	},
+	"odd": func(n number) bool {
+		if n.isFloat {
+			return isInteger(n.f) && math.Mod(n.f, 2) != 0
+		}
+		return n.mag%2 == 1
+	},
+}
+
+// number holds the value of an integer as a sign and magnitude, so
+// that every int64 and uint64 is represented exactly, or the value of
+// a float.
+type number struct {
+	isFloat  bool
+	f        float64
+	negative bool
+	mag      uint64
+}
+
+// float returns the number as a float64, which may lose precision.
+func (n number) float() float64 {
+	if n.isFloat {
+		return n.f
+	}
+	if n.negative {
+		return -float64(n.mag)
+	}
+	return float64(n.mag)
+}
+
+// compare returns -1, 0 or 1 as n is less than, equal to or greater
+// than m.  Integers are compared exactly, and are only converted to
+// floats when compared with a float.
+func (n number) compare(m number) int {
+	if n.isFloat || m.isFloat {
+		a, b := n.float(), m.float()
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+
+	if n.mag == 0 && m.mag == 0 {
+		return 0
+	}
+	if n.negative != m.negative {
+		if n.negative {
+			return -1
+		}
+		return 1
+	}
+
+	c := 0
+	switch {
+	case n.mag < m.mag:
+		c = -1
+	case n.mag > m.mag:
+		c = 1
+	}
+	if n.negative {
+		c = -c
+	}
+	return c
+}
+
+// checkConstraints validates a numeric field's value against
+// each of the comma-separated constraints in its "constraint" tag.
+func checkConstraints(t reflect.StructField, v reflect.Value, o *options) error {
+	tag, ok := t.Tag.Lookup("constraint")
+	if !ok {
+		return nil
+	}
+
+	n, ok := numericValue(v)
+	if !ok {
+		return fmt.Errorf("constraint tag is not supported for %s", v.Kind())
+	}
+
+	for _, name := range split(tag, ",") {
+		predicate, ok := constraints[name]
+		if !ok {
+			return fmt.Errorf("invalid constraint tag %q: unknown constraint %q", tag, name)
+		}
+		if !predicate(n) {
+			return fmt.Errorf("value of '%s' is '%v', but does not satisfy constraint '%s'", o.key(t, t.Tag.Get("env")), redact(t, fmt.Sprint(v.Interface()), o), name)
+		}
+	}
+
+	return nil
+}
+
+// comparisons are the operators that can be used in a struct-level
+// constraint, longest first so that "<=" isn't mistaken for "<".
+// Each is given the result of comparing the two fields' values.
+var comparisons = []struct {
+	op    string
+	holds func(c int) bool
+}{
+	{"<=", func(c int) bool { return c <= 0 }},
+	{">=", func(c int) bool { return c >= 0 }},
+	{"==", func(c int) bool { return c == 0 }},
+	{"!=", func(c int) bool { return c != 0 }},
+	{"<", func(c int) bool { return c < 0 }},
+	{">", func(c int) bool { return c > 0 }},
+}
+
+// checkStructConstraints validates the comparisons between fields in
+// the "constraint" tags of fields that aren't otherwise set, such as
+// `_ struct{} constraint:"MinPort<=MaxPort"`, once all fields have
+// been set.  Each comparison is between two named numeric fields, and
+// several comparisons can be separated with commas.
+func checkStructConstraints(t reflect.Type, v reflect.Value, o *options) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isSetFromTags(f) {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("constraint")
+		if !ok {
+			continue
+		}
+
+		for _, expr := range split(tag, ",") {
+			if err := checkComparison(t, v, expr, o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isSetFromTags returns whether the field is set by Set, rather than
+// only holding struct-level tags.
+func isSetFromTags(f reflect.StructField) bool {
+	for _, name := range []string{"env", "tail", "merge", "oneof"} {
+		if _, ok := f.Tag.Lookup(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func checkComparison(t reflect.Type, v reflect.Value, expr string, o *options) error {
+	for _, c := range comparisons {
+		i := strings.Index(expr, c.op)
+		if i < 0 {
+			continue
+		}
+
+		names := [2]string{strings.TrimSpace(expr[:i]), strings.TrimSpace(expr[i+len(c.op):])}
+		var values [2]number
+		var rendered [2]string
+		for j, name := range names {
+			f, ok := t.FieldByName(name)
+			if !ok || name == "" {
+				return fmt.Errorf("invalid constraint %q: unknown field %q", expr, name)
+			}
+			fv := v.FieldByIndex(f.Index)
+			if values[j], ok = numericValue(fv); !ok {
+				return fmt.Errorf("invalid constraint %q: %s is not numeric", expr, name)
+			}
+			rendered[j] = redact(f, fmt.Sprint(fv.Interface()), o)
+		}
+
+		if !c.holds(values[0].compare(values[1])) {
+			return fmt.Errorf("constraint '%s' is not satisfied: %s is '%s' and %s is '%s'", expr, names[0], rendered[0], names[1], rendered[1])
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid constraint %q: expected a comparison such as 'Min<=Max'", expr)
+}
+
+// numericValue returns the value of an integer or float as a number.
+func numericValue(v reflect.Value) (number, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			// Negating as unsigned is exact, even for the minimum int64.
+			return number{negative: true, mag: -uint64(i)}, true
+		}
+		return number{mag: uint64(i)}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return number{mag: v.Uint()}, true
+	case reflect.Float32, reflect.Float64:
+		return number{isFloat: true, f: v.Float()}, true
+	}
+	return number{}, false
+}
+
+func isInteger(f float64) bool {
+	return f == math.Trunc(f)
+}
+
+func isPow2(u uint64) bool {
+	return u&(u-1) == 0
+}
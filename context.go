@@ -0,0 +1,81 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// ContextSetter is implemented by fields whose values are set by an
+// operation that may block, such as fetching a certificate, and which
+// should stop when the context given to SetCtx is done.  It is used
+// in preference to Setter for fields that implement both.
+type ContextSetter interface {
+	SetContext(ctx context.Context, value string) error
+}
+
+// isSetter returns whether the value implements Setter or
+// ContextSetter.
+func isSetter(i interface{}) bool {
+	switch i.(type) {
+	case Setter, ContextSetter:
+		return true
+	}
+	return false
+}
+
+// SetCtx sets the fields of a struct as per Set, passing ctx to every
+// ContextLookuper, ContextSetter, and transform or default func
+// registered with a context.  Once ctx is done, no further fields are
+// set and a *ContextError naming the field that was being set and
+// wrapping ctx.Err() is returned.  Fields already set by then keep
+// their new values, so the struct should be discarded, or set into a
+// copy with SetCopy, if SetCtx can be cancelled.
+func SetCtx(ctx context.Context, i interface{}, opts ...Option) (err error) {
+	o := newOptions(opts)
+	o.ctx = ctx
+	return set(i, o)
+}
+
+// ContextError is returned by SetCtx when its context is done before
+// every field has been set.
+type ContextError struct {
+	// Field is the name of the field that was being set.
+	Field string
+
+	// Err is the error returned by the context's Err method.
+	Err error
+}
+
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("error setting %q: %v", e.Field, e.Err)
+}
+
+// Unwrap returns the context's error, so that errors.Is can be used
+// to tell whether the context was cancelled or timed out.
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
+
+// checkContext returns an error, naming the field about to be set, if
+// the context is done.
+func checkContext(t reflect.StructField, o *options) error {
+	if err := o.ctx.Err(); err != nil {
+		return &ContextError{Field: t.Name, Err: err}
+	}
+	return nil
+}
+
+// contextError replaces the error returned while setting a field with
+// one naming the field if the context is done, as the error is then
+// most likely to have been caused by a lookup or setter that stopped
+// because of it.
+func contextError(t reflect.StructField, err error, o *options) error {
+	if _, ok := err.(*ContextError); ok {
+		return err
+	}
+	if ctxErr := checkContext(t, o); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
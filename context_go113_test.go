@@ -0,0 +1,41 @@
+//go:build go1.13
+// +build go1.13
+
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetCtxErrorIs(t *testing.T) {
+	unsetEnvironment()
+
+	config := struct {
+		Host  string `env:"HOST"`
+		Token string `env:"TOKEN"`
+	}{}
+
+	// Cancelled while a lookup is blocked.
+	l := &slowLookuper{values: map[string]string{"HOST": "example.com"}, slow: map[string]bool{"TOKEN": true}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	err := SetCtx(ctx, &config, WithContextLookuper(l))
+	ErrorNotNil(t, err)
+	Equals(t, `error setting "Token": context deadline exceeded`, err.Error())
+	Assert(t, errors.Is(err, context.DeadlineExceeded))
+
+	// Cancelled before any field is set.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	err = SetCtx(ctx, &config, WithContextLookuper(l))
+	ErrorNotNil(t, err)
+	Assert(t, errors.Is(err, context.Canceled))
+	var ctxErr *ContextError
+	Assert(t, errors.As(err, &ctxErr))
+	Equals(t, "Host", ctxErr.Field)
+}
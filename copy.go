@@ -0,0 +1,105 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SetCopy sets the fields of a deep copy of the struct pointed to by
+// src, returning a pointer to the copy only if every field was set
+// without error.  The struct pointed to by src is never modified, so
+// a live configuration can be updated transactionally:
+//
+//	next, err := env.SetCopy(current)
+//	if err == nil {
+//		current = next.(*config)
+//	}
+//
+// Exported fields are copied deeply, while unexported fields are
+// copied as they are.
+func SetCopy(src interface{}, opts ...Option) (interface{}, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, fmt.Errorf("%s is not a pointer", v.Kind())
+	}
+
+	dst := deepCopy(v, map[copiedPointer]reflect.Value{})
+	if err := Set(dst.Interface(), opts...); err != nil {
+		return nil, err
+	}
+	return dst.Interface(), nil
+}
+
+// copiedPointer identifies a pointer that has been copied.  The type
+// is needed as well as the address, as a pointer to a struct and a
+// pointer to its first field share an address.
+type copiedPointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// deepCopy returns a copy of the value, copying whatever pointers,
+// slices, maps and interfaces it holds rather than sharing them.
+// Pointers already copied are reused, so cycles are preserved.
+func deepCopy(v reflect.Value, copied map[copiedPointer]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := copiedPointer{addr: v.Pointer(), typ: v.Type()}
+		if c, ok := copied[p]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copied[p] = c
+		c.Elem().Set(deepCopy(v.Elem(), copied))
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i), copied))
+			}
+		}
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, deepCopy(v.MapIndex(k), copied))
+		}
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), copied))
+		return c
+	}
+	return v
+}
@@ -0,0 +1,96 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	defaultFuncsMu sync.RWMutex
+	defaultFuncs   = map[string]func(context.Context, interface{}) (string, error){}
+)
+
+type pendingDefault struct {
+	field reflect.StructField
+	value reflect.Value
+	key   string
+	name  string
+}
+
+// RegisterDefaultFunc registers a function that produces the default
+// value of any field tagged with `default:"#name"`, allowing defaults
+// to be derived from other fields.  The function is called with a
+// pointer to the struct being set, once all fields without a default
+// func have been set.  Default funcs are called in field order, so a
+// function that reads a field set by a later default func sees that
+// field's previous value; default funcs cannot depend on each other
+// cyclically.
+func RegisterDefaultFunc(name string, f func(i interface{}) (string, error)) {
+	RegisterDefaultFuncContext(name, func(_ context.Context, i interface{}) (string, error) {
+		return f(i)
+	})
+}
+
+// RegisterDefaultFuncContext registers a default func as per
+// RegisterDefaultFunc, for functions that may block, such as those
+// that call a remote service.  The function is called with the
+// context given to SetCtx, or context.Background() otherwise.
+func RegisterDefaultFuncContext(name string, f func(ctx context.Context, i interface{}) (string, error)) {
+	defaultFuncsMu.Lock()
+	defer defaultFuncsMu.Unlock()
+	defaultFuncs[name] = f
+}
+
+// defaultFuncName returns the name of the default func referenced by
+// a default tag, if any.
+func defaultFuncName(d string) (string, bool) {
+	if !strings.HasPrefix(d, "#") {
+		return "", false
+	}
+	return d[1:], true
+}
+
+// resolveDefaultFuncs sets each of the fields whose default is
+// produced by a default func.
+func resolveDefaultFuncs(i interface{}, o *options) (err error) {
+	for _, p := range o.defaultFuncs {
+		if err = checkContext(p.field, o); err != nil {
+			return
+		}
+
+		defaultFuncsMu.RLock()
+		f, ok := defaultFuncs[p.name]
+		defaultFuncsMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("default value of '%s' refers to unknown default func %q", p.key, p.name)
+		}
+
+		var d string
+		if d, err = f(o.ctx, i); err != nil {
+			return fmt.Errorf("error in default func %q for '%s': %v", p.name, p.key, err)
+		}
+		if d, err = transform(p.field, d, o); err != nil {
+			return
+		}
+
+		choices, ok := p.field.Tag.Lookup("choices")
+		if ok && hasParsedChoices(p.field) {
+			var parsed string
+			if parsed, err = checkNumericChoice(p.field, choices, d, o); err != nil {
+				return fmt.Errorf("default value of '%s' is '%s', but %v", p.key, redact(p.field, d, o), err)
+			}
+			d = parsed
+		} else if ok && !validChoice(choices, d, getDelimiter(p.field, o)) {
+			return fmt.Errorf("default value of '%s' is '%s', but not set or subset of '%s'", p.key, redact(p.field, d, o), choices)
+		}
+
+		o.resolved[p.field.Tag.Get("env")] = d
+		if err = assign(p.field, p.value, d, o); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// DiffEnvs resolves the struct pointed to by i against each of the
+// environments a and b, returning the fields whose values differ,
+// keyed by field name, with the value under a and the value under b.
+// Values are rendered with fmt.Sprint, and secrets are masked in both
+// columns.  The struct pointed to by i is never modified, so DiffEnvs
+// can be used to review a deployment before it happens:
+//
+//	diff, err := env.DiffEnvs(&config{}, staging, production)
+//
+// Neither environment falls through to the process's environment.
+func DiffEnvs(i interface{}, a, b map[string]string) (map[string][2]string, error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a pointer to a struct", v.Kind())
+	}
+
+	resolve := func(name string, environment map[string]string) (reflect.Value, error) {
+		dst := deepCopy(v, map[copiedPointer]reflect.Value{})
+		if err := Set(dst.Interface(), WithLookuper(mapLookuper(environment))); err != nil {
+			return reflect.Value{}, fmt.Errorf("error resolving %s: %v", name, err)
+		}
+		return dst.Elem(), nil
+	}
+
+	va, err := resolve("a", a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := resolve("b", b)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(nil)
+	diff := map[string][2]string{}
+	t := va.Type()
+	for f := 0; f < t.NumField(); f++ {
+		field := t.Field(f)
+		if _, ok := field.Tag.Lookup("env"); !ok || field.PkgPath != "" {
+			continue
+		}
+
+		x, y := va.Field(f).Interface(), vb.Field(f).Interface()
+		if reflect.DeepEqual(x, y) {
+			continue
+		}
+		diff[field.Name] = [2]string{
+			redact(field, fmt.Sprint(x), o),
+			redact(field, fmt.Sprint(y), o),
+		}
+	}
+	return diff, nil
+}
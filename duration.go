@@ -0,0 +1,144 @@
+package env
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkDuration applies the duration-specific tags to a parsed
+// time.Duration field.  A field tagged `nonneg:"true"` rejects
+// negative durations, unless it is also tagged `clamp:"true"`, in
+// which case negative durations are clamped to zero with a warning.
+func checkDuration(t reflect.StructField, v reflect.Value, o *options) (err error) {
+	if err = checkPrecision(t, v, o); err != nil {
+		return
+	}
+
+	nonneg, err := boolTag(t, "nonneg")
+	if err != nil || !nonneg {
+		return
+	}
+
+	if v.Type() != durationType {
+		return fmt.Errorf("nonneg tag is not supported for %v", v.Type())
+	}
+
+	d := time.Duration(v.Int())
+	if d >= 0 {
+		return
+	}
+
+	clamp, err := boolTag(t, "clamp")
+	if err != nil {
+		return
+	}
+	if !clamp {
+		return fmt.Errorf("value of '%s' is '%s', but must not be negative", o.key(t, t.Tag.Get("env")), redact(t, d.String(), o))
+	}
+
+	v.SetInt(0)
+	o.warn("value of '%s' was negative and has been clamped to 0s", o.key(t, t.Tag.Get("env")))
+	return
+}
+
+// checkPrecision validates that a time.Duration field tagged with a
+// "precision", such as `precision:"1s"`, is a multiple of it.  If the
+// field is also tagged with `clamp:"true"`, the duration is instead
+// rounded to the nearest multiple, with a warning.
+func checkPrecision(t reflect.StructField, v reflect.Value, o *options) error {
+	precisionTag, ok := t.Tag.Lookup("precision")
+	if !ok {
+		return nil
+	}
+
+	if v.Type() != durationType {
+		return fmt.Errorf("precision tag is not supported for %v", v.Type())
+	}
+
+	precision, err := time.ParseDuration(precisionTag)
+	if err != nil || precision <= 0 {
+		return fmt.Errorf("invalid precision tag %q: expected a positive duration", precisionTag)
+	}
+
+	d := time.Duration(v.Int())
+	if d%precision == 0 {
+		return nil
+	}
+
+	clamp, err := boolTag(t, "clamp")
+	if err != nil {
+		return err
+	}
+	if !clamp {
+		return fmt.Errorf("value of '%s' is '%s', but must be a multiple of %v", o.key(t, t.Tag.Get("env")), redact(t, d.String(), o), precision)
+	}
+
+	rounded := d.Round(precision)
+	v.SetInt(int64(rounded))
+	o.warn("value of '%s' was not a multiple of %v and has been rounded to %v", o.key(t, t.Tag.Get("env")), precision, redact(t, rounded.String(), o))
+	return nil
+}
+
+// setDurationFormat sets a time.Duration field from a value in the
+// format given by its "duration_format" tag.
+func setDurationFormat(v reflect.Value, value string, format string) error {
+	if v.Type() != durationType {
+		return fmt.Errorf("duration_format tag is not supported for %v", v.Type())
+	}
+
+	if format != "clock" {
+		return fmt.Errorf("invalid duration_format tag %q: expected 'clock'", format)
+	}
+
+	d, err := parseClock(value)
+	if err != nil {
+		return err
+	}
+	v.SetInt(int64(d))
+	return nil
+}
+
+// parseClock parses a duration expressed as clock time, either
+// HH:MM:SS or MM:SS, so "01:30:00" is 90 minutes.  Minutes and
+// seconds must be less than 60, unless they are the leading part, and
+// the duration must fit in a time.Duration.
+func parseClock(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid clock duration %q: expected HH:MM:SS or MM:SS", value)
+	}
+
+	var d time.Duration
+	units := []time.Duration{time.Second, time.Minute, time.Hour}[:len(parts)]
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid clock duration %q: expected HH:MM:SS or MM:SS", value)
+		}
+		unit := units[len(parts)-1-i]
+		if n > uint64(math.MaxInt64/unit) || time.Duration(n)*unit > math.MaxInt64-d {
+			return 0, fmt.Errorf("invalid clock duration %q: overflows time.Duration", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// boolTag returns the Boolean value of the given tag, which is false
+// if the tag is not present.
+func boolTag(t reflect.StructField, name string) (bool, error) {
+	tag, ok := t.Tag.Lookup(name)
+	if !ok {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(tag)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s tag %q: %v", name, tag, err)
+	}
+	return b, nil
+}
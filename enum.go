@@ -0,0 +1,132 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	enumsMu sync.RWMutex
+	enums   = map[reflect.Type]map[string]reflect.Value{}
+)
+
+// RegisterEnum registers the names of the values of an enumerated
+// type, allowing fields of that type to be set by name.  All of the
+// values must be of the same type, for example:
+//
+//	env.RegisterEnum(map[string]interface{}{
+//		"debug": LevelDebug,
+//		"info":  LevelInfo,
+//	})
+func RegisterEnum(values map[string]interface{}) {
+	if len(values) == 0 {
+		panic("env: RegisterEnum requires at least one value")
+	}
+
+	var typ reflect.Type
+	names := map[string]reflect.Value{}
+	for name, value := range values {
+		v := reflect.ValueOf(value)
+		if typ == nil {
+			typ = v.Type()
+		} else if v.Type() != typ {
+			panic(fmt.Sprintf("env: RegisterEnum values must be of the same type, got %v and %v", typ, v.Type()))
+		}
+		names[name] = v
+	}
+
+	enumsMu.Lock()
+	defer enumsMu.Unlock()
+	enums[typ] = names
+}
+
+func lookupEnum(t reflect.Type) (map[string]reflect.Value, bool) {
+	enumsMu.RLock()
+	defer enumsMu.RUnlock()
+
+	names, ok := enums[t]
+	return names, ok
+}
+
+func setEnum(fieldValue reflect.Value, value string, names map[string]reflect.Value) error {
+	v, ok := names[value]
+	if !ok {
+		return fmt.Errorf("unknown %v %q, expected one of %s", fieldValue.Type(), value, strings.Join(enumNames(names), ", "))
+	}
+
+	fieldValue.Set(v)
+	return nil
+}
+
+func enumNames(names map[string]reflect.Value) []string {
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// VerifyChoices checks that the "choices" tag of every field whose
+// type is a registered enum lists exactly the registered names of
+// the enum, reporting any that are missing or unknown.  Neither the
+// struct nor the environment are consulted for values, making this
+// suitable for use in tests.
+func VerifyChoices(i interface{}) error {
+	t := reflect.TypeOf(i)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%v is not a pointer to a struct", t)
+	}
+	t = t.Elem()
+
+	var problems []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		choices, ok := f.Tag.Lookup("choices")
+		if !ok {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+
+		names, ok := lookupEnum(ft)
+		if !ok {
+			continue
+		}
+
+		listed := map[string]bool{}
+		var unknown []string
+		for _, choice := range split(choices, getDelimiter(f, nil)) {
+			listed[choice] = true
+			if _, ok := names[choice]; !ok {
+				unknown = append(unknown, choice)
+			}
+		}
+
+		var missing []string
+		for _, name := range enumNames(names) {
+			if !listed[name] {
+				missing = append(missing, name)
+			}
+		}
+
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("choices of %q are missing %s", f.Name, strings.Join(missing, ", ")))
+		}
+		if len(unknown) > 0 {
+			problems = append(problems, fmt.Sprintf("choices of %q include unknown %s", f.Name, strings.Join(unknown, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
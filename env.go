@@ -2,7 +2,6 @@ package env
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -24,7 +23,80 @@ type Setter interface {
 // Set sets the fields of a struct from environment config.
 // If a field is unexported or required configuration is not
 // found, an error will be returned.
-func Set(i interface{}) (err error) {
+func Set(i interface{}, opts ...Option) (err error) {
+	return set(i, newOptions(opts))
+}
+
+// SetWithPrefix sets the fields of a struct from environment config,
+// prepending the given prefix to the name of each environment
+// variable, unless the field is tagged with `no_prefix:"true"`.
+func SetWithPrefix(prefix string, i interface{}, opts ...Option) (err error) {
+	return Set(i, append([]Option{WithPrefix(prefix)}, opts...)...)
+}
+
+// SetWithOverrides sets the fields of a struct from environment
+// config, taking values from the given overrides in preference to the
+// environment, without modifying the environment.  An override with
+// an empty value is present, in the same way as an empty environment
+// variable is.
+func SetWithOverrides(overrides map[string]string, i interface{}, opts ...Option) (err error) {
+	return Set(i, append([]Option{WithLookuper(overrideLookuper(overrides))}, opts...)...)
+}
+
+// SetLayered sets the fields of a struct from the given layers, as
+// per WithLayers.  For example, layers with the prefixes "TENANT_" and
+// "" look up a field tagged with `env:"DB_HOST"` as TENANT_DB_HOST and
+// then as DB_HOST.
+func SetLayered(layers []Layer, i interface{}, opts ...Option) (err error) {
+	return Set(i, append([]Option{WithLayers(layers...)}, opts...)...)
+}
+
+// ResetToDefaults sets the fields of a struct to the values of their
+// "default" tags, ignoring the environment entirely.  Fields without
+// a default are set to their zero value, even if they are required.
+func ResetToDefaults(i interface{}) (err error) {
+	o := newOptions(nil)
+	o.defaultsOnly = true
+	return set(i, o)
+}
+
+// ValidateDefaults checks that the "default" tag of every field can
+// be converted to the field's type, without modifying the struct or
+// consulting the environment.  This catches invalid defaults that
+// would otherwise go unnoticed until an environment variable is
+// missing.  Default funcs and template defaults aren't checked.
+func ValidateDefaults(i interface{}) (err error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("%s is not a pointer", v.Kind())
+	}
+
+	return validateDefaults(v.Type().Elem(), newOptions(nil))
+}
+
+// validateDefaults applies the defaults to a scratch copy of a struct
+// of the given type, using the caller's options so that defaults are
+// converted exactly as they would be by Set.  Defaults produced by
+// default funcs or rendered as templates depend on the values of
+// other fields, so they aren't validated.
+func validateDefaults(t reflect.Type, o *options) error {
+	scratch := *o
+	scratch.defaultsOnly = true
+	scratch.validateDefaults = false
+	scratch.validatingDefaults = true
+	scratch.resolved = map[string]string{}
+	scratch.layerHits = map[string]layerHit{}
+	scratch.result = nil
+	scratch.defaultFuncs = nil
+	scratch.templates = nil
+
+	if err := set(reflect.New(t).Interface(), &scratch); err != nil {
+		return fmt.Errorf("invalid default: %v", err)
+	}
+	return nil
+}
+
+func set(i interface{}, o *options) (err error) {
 	v := reflect.ValueOf(i)
 
 	// Don't try to process a non-pointer value.
@@ -32,26 +104,76 @@ func Set(i interface{}) (err error) {
 		return fmt.Errorf("%s is not a pointer", v.Kind())
 	}
 
+	if o.validateDefaults {
+		if err = validateDefaults(v.Type().Elem(), o); err != nil {
+			return
+		}
+	}
+
 	v = v.Elem()
 	t := reflect.TypeOf(i).Elem()
 
 	for i := 0; i < t.NumField(); i++ {
-		if err = processField(t.Field(i), v.Field(i)); err != nil {
+		// Stop promptly once the context is done, regardless of
+		// whether a result is being collected.
+		if err = checkContext(t.Field(i), o); err != nil {
 			return
 		}
+		if err = processField(t.Field(i), v.Field(i), o); err != nil {
+			err = contextError(t.Field(i), err, o)
+
+			// When collecting a result, carry on setting the
+			// remaining fields.
+			if o.result == nil {
+				return
+			}
+			o.result.Errors = append(o.result.Errors, err)
+		}
+	}
+	if o.result != nil && len(o.result.Errors) > 0 {
+		return nil
 	}
 
-	return
+	if o.validatingDefaults {
+		return
+	}
+
+	if err = resolveDefaultFuncs(i, o); err != nil {
+		return
+	}
+
+	if err = renderTemplates(v, o); err != nil {
+		return
+	}
+
+	if o.defaultsOnly {
+		return
+	}
+	if err = checkRelations(t, o); err != nil {
+		return
+	}
+	return checkStructConstraints(t, v, o)
 }
 
 // processField will lookup the "env" tag for the property
 // and attempt to set it.  If not found, another check for the
 // "required" tag will be performed to decided whether an error
 // needs to be returned.
-func processField(t reflect.StructField, v reflect.Value) (err error) {
+func processField(t reflect.StructField, v reflect.Value, o *options) (err error) {
+	// Oneof fields group sub-structs, exactly one of which must be
+	// configured.
+	if tag, ok := t.Tag.Lookup("oneof"); ok {
+		return processOneOf(t, v, tag, o)
+	}
+
+	mergeTag, merged := t.Tag.Lookup("merge")
 	envTag, ok := t.Tag.Lookup("env")
-	if !ok {
-		return
+	if !ok && !merged {
+		// Tail fields are set from the remainder of the environment
+		// variable named by the tag.
+		if envTag, ok = t.Tag.Lookup("tail"); !ok {
+			return
+		}
 	}
 
 	// If the field is unexported or just not settable, bail at
@@ -60,42 +182,223 @@ func processField(t reflect.StructField, v reflect.Value) (err error) {
 		return fmt.Errorf("field '%s' cannot be set", t.Name)
 	}
 
+	// Merged fields are set from the values of several environment
+	// variables, rather than from the env tag.
+	if merged {
+		return processMerge(t, v, mergeTag, o)
+	}
+
+	// The key is the name of the environment variable to look up,
+	// which may be prefixed.
+	key := o.key(t, envTag)
+
+	// Unknown transforms and units are reported whether or not the
+	// environment variable is set.
+	if err = checkTransforms(t); err != nil {
+		return
+	}
+	if err = checkUnit(t); err != nil {
+		return
+	}
+
+	// Indexed fields are set from a sequence of numbered environment
+	// variables, falling back to a default if none are found.
+	var found bool
+	if found, err = processIndexed(t, v, key, o); err != nil || found {
+		if err == nil {
+			o.source(key, sourceEnvironment)
+		}
+		return
+	}
+
+	// Indexed struct fields are set from groups of numbered
+	// environment variables, one struct per index.
+	if found, err = processIndexedStructs(t, v, key, o); err != nil || found {
+		if err == nil {
+			o.source(key, sourceEnvironment)
+		}
+		return
+	}
+
+	// Wildcard fields are set from every environment variable that
+	// matches the pattern.
+	if found, err = processWildcard(t, v, key, o); err != nil || found {
+		if err == nil {
+			o.source(key, sourceEnvironment)
+		}
+		return
+	}
+
 	// Lookup the environment variable and if found,
 	// check if valid against choices struc tag before setting
-	env, ok := os.LookupEnv(envTag)
+	env, ok, err := o.lookup(key)
+	if err != nil {
+		return
+	}
+	if ok && o.isNullToken(env) {
+		o.warn("value of '%s' is the null token '%s' and has been treated as missing", key, redact(t, env, o))
+		ok = false
+	}
+
+	// An empty value is treated as missing, unless the field allows
+	// it, in which case the field is set to its zero value.  An empty
+	// value for a set is always present, and is an empty set, which is
+	// a subset of any choices.
+	allowEmpty, err := boolTag(t, "allow_empty")
+	if err != nil {
+		return
+	}
+	if ok && len(env) == 0 && (allowEmpty || isSet(t.Type)) {
+		if choices, ok := t.Tag.Lookup("choices"); ok && !isSet(t.Type) && !validChoice(choices, env, getDelimiter(t, o)) {
+			return fmt.Errorf("value of '%s' is '', but not a set or subset of '%s'", key, choices)
+		}
+		o.resolved[envTag] = env
+		o.source(key, sourceEnvironment)
+		if o.presenceOnly {
+			return
+		}
+		if isSet(t.Type) {
+			return setSet(t, v, env, o)
+		}
+		v.Set(reflect.Zero(t.Type))
+		return
+	}
+
 	if ok && len(env) != 0 { // skip this block if env var is empty
+		if o.unquote {
+			env = unquoteValue(t, env, o)
+		}
+
+		// Without conversion, all that matters is that the value is
+		// present, so it isn't decrypted or transformed either.
+		if o.presenceOnly {
+			o.resolved[envTag] = env
+			o.source(key, sourceEnvironment)
+			return
+		}
+		if env, err = decrypt(t, key, env, o); err != nil {
+			return
+		}
+		if env, err = transform(t, env, o); err != nil {
+			return
+		}
+		o.resolved[envTag] = env
+		o.source(key, sourceEnvironment)
+
 		// check if choices tag is set and if env var value is valid choice
 		choices, ok := t.Tag.Lookup("choices")
-		if ok && !validChoice(choices, env, getDelimiter(t)) {
-			return fmt.Errorf("value of '%s' is '%s', but not a set or subset of '%s'", envTag, env, choices)
+		if ok && hasParsedChoices(t) {
+			var parsed string
+			if parsed, err = checkNumericChoice(t, choices, env, o); err != nil {
+				return withExample(t, fmt.Errorf("value of '%s' is '%s', but %v", key, redact(t, env, o), err))
+			}
+			env = parsed
+		} else if ok && !validChoice(choices, env, getDelimiter(t, o)) {
+			return withExample(t, fmt.Errorf("value of '%s' is '%s', but not a set or subset of '%s'", key, redact(t, env, o), choices))
 		}
-		return setField(t, v, env)
+		return withExample(t, assign(t, v, env, o))
+	}
+
+	// With code defaults, a value assigned to the field before Set
+	// was called takes precedence over the default tag.
+	if o.codeDefaults && hasCodeDefault(t, v) {
+		o.resolved[envTag] = fmt.Sprint(v.Interface())
+		o.source(key, sourceCode)
+		return
 	}
 
 	// If the value isn't found in the environment, look for a
 	// user-defined default value, but first check the default
 	// against valid choices (if any were suplied).
 	d, ok := t.Tag.Lookup("default")
+	if !ok {
+		if d, ok, err = firstChoice(t, o); err != nil {
+			return
+		}
+	}
 	if ok {
+		// Defaults produced by a default func are resolved once all
+		// other fields have been set.
+		if name, ok := defaultFuncName(d); ok {
+			o.defaultFuncs = append(o.defaultFuncs, pendingDefault{field: t, value: v, key: key, name: name})
+			o.source(key, sourceDefault)
+			return
+		}
+		if o.presenceOnly {
+			o.resolved[envTag] = d
+			o.source(key, sourceDefault)
+			return
+		}
+
+		if d, err = transform(t, d, o); err != nil {
+			return
+		}
+
 		choices, ok := t.Tag.Lookup("choices")
-		if ok && !validChoice(choices, d, getDelimiter(t)) {
-			return fmt.Errorf("default value of '%s' is '%s', but not set or subset of '%s'", envTag, d, choices)
+		if ok && hasParsedChoices(t) {
+			var parsed string
+			if parsed, err = checkNumericChoice(t, choices, d, o); err != nil {
+				return fmt.Errorf("default value of '%s' is '%s', but %v", key, redact(t, d, o), err)
+			}
+			d = parsed
+		} else if ok && !validChoice(choices, d, getDelimiter(t, o)) {
+			return fmt.Errorf("default value of '%s' is '%s', but not set or subset of '%s'", key, redact(t, d, o), choices)
 		}
-		return setField(t, v, d)
+		o.resolved[envTag] = d
+		o.source(key, sourceDefault)
+		return assign(t, v, d, o)
+	}
+
+	// When resetting to defaults, fields without a default are reset
+	// to their zero value, regardless of whether they're required.
+	if o.defaultsOnly {
+		v.Set(reflect.Zero(t.Type))
+		return
 	}
 
 	// An env tag has been provided but a matching environment
 	// variable cannot be found, determine if we should return
 	// an error or if a missing variable is ok/expected.
-	return processMissing(t, envTag, configTypeEnvironment)
+	return processMissing(t, key, configTypeEnvironment, o)
+}
+
+// decrypt passes the value through the registered decryptor if
+// the field has been tagged as encrypted.  Errors returned by the
+// decryptor are deliberately not included in the returned error, to
+// avoid leaking either the ciphertext or the plaintext.
+func decrypt(t reflect.StructField, envTag string, value string, o *options) (string, error) {
+	encTag, ok := t.Tag.Lookup("encrypted")
+	if !ok {
+		return value, nil
+	}
+
+	b, err := strconv.ParseBool(encTag)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted tag %q: %v", encTag, err)
+	}
+	if !b {
+		return value, nil
+	}
+
+	if o.decryptor == nil {
+		return "", fmt.Errorf("%s is encrypted but no decryptor was provided", envTag)
+	}
+
+	plaintext, err := o.decryptor(value)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting %s", envTag)
+	}
+	return plaintext, nil
 }
 
 // checks csv list of choices to see if it contains a particular value
 // fortunately, env vars only contain string values, so we can easily
-// validate against a list of choices prior to type conversion
+// validate against a list of choices prior to type conversion.  An
+// empty value is only valid if the choices contain an empty token,
+// such as ",a,b".
 // TODO: Does the delimiter tag apply to both choices and values?
 func validChoice(choices, values string, delim string) bool {
-	if len(values) == 0 || len(choices) == 0 {
+	if len(choices) == 0 {
 		return false
 	}
 	for _, choice := range strings.Split(choices, delim) {
@@ -108,16 +411,102 @@ func validChoice(choices, values string, delim string) bool {
 	return false
 }
 
-func setField(t reflect.StructField, v reflect.Value, value string) (err error) {
+// assign sets the field to the given value, unless the field's
+// value is a template, in which case setting is deferred until all
+// other fields have been set.
+func assign(t reflect.StructField, v reflect.Value, value string, o *options) (err error) {
+	var ok bool
+	if value, ok, err = headTail(t, value, o); err != nil {
+		return
+	}
+	if !ok {
+		v.Set(reflect.Zero(t.Type))
+		return
+	}
+
+	if tmplTag, ok := t.Tag.Lookup("template"); ok {
+		var b bool
+		if b, err = strconv.ParseBool(tmplTag); err != nil {
+			return fmt.Errorf("invalid template tag %q: %v", tmplTag, err)
+		}
+		if b {
+			o.templates = append(o.templates, pendingTemplate{field: t, value: v, text: value})
+			return
+		}
+	}
+
+	return setField(t, v, value, o)
+}
+
+func setField(t reflect.StructField, v reflect.Value, value string, o *options) (err error) {
+	// Errors returned from parsing often contain the value being
+	// parsed, which must not be exposed for secret fields.
+	defer func() {
+		if err != nil && isSecret(t) {
+			err = redactError(err, value, redact(t, value, o))
+		}
+	}()
+
+	if err = checkMinLen(t, value, o); err != nil {
+		return
+	}
+
+	if err = validateSchema(t, value, o); err != nil {
+		return
+	}
+
+	// Formatted values are decoded rather than parsed.
+	if format, ok := t.Tag.Lookup("format"); ok {
+		return setFormatted(t, v, value, format, o)
+	}
+
+	// Network interfaces are looked up by name on the host.
+	if t.Type == interfaceType {
+		if err = setInterface(v, value); err != nil {
+			return fmt.Errorf("error setting %q: %v", t.Name, err)
+		}
+		return
+	}
+
+	// Times are parsed using the field's layout.
+	if t.Type == timeType {
+		if err = setTime(v, value, getLayout(t)); err != nil {
+			return fmt.Errorf("error setting %q: %v", t.Name, err)
+		}
+		return
+	}
+
+	// URLs are parsed with url.Parse.
+	if t.Type == urlType {
+		if err = setURL(v, value); err != nil {
+			return fmt.Errorf("error setting %q: %v", t.Name, err)
+		}
+		return checkScheme(t, v, o)
+	}
+
+	// Months and weekdays are set by name or by number.
+	if t.Type == monthType || t.Type == weekdayType {
+		if err = setCalendar(v, value); err != nil {
+			return fmt.Errorf("error setting %q: %v", t.Name, err)
+		}
+		return
+	}
+
 	// If field implements the Setter interface, invoke it now and
 	// don't continue attempting to set the primitive values.
-	if _, ok := v.Interface().(Setter); ok {
-		instance := reflect.New(t.Type.Elem())
-		v.Set(instance)
+	if target, ok := setterTarget(v); ok {
+		// Setters provided by this package may be configured by the
+		// field's tags.
+		if ts, ok := target.Interface().(tagSetter); ok {
+			ts.setTag(t.Tag, getDelimiter(t, o))
+		}
 
-		// Re-assert the type with the newed-up instance and call.
-		setter := v.Interface().(Setter)
-		if err = setter.Set(value); err != nil {
+		if setter, ok := target.Interface().(ContextSetter); ok {
+			err = setter.SetContext(o.ctx, value)
+		} else {
+			err = target.Interface().(Setter).Set(value)
+		}
+		if err != nil {
 			return fmt.Errorf("error in custom setter: %v", err)
 		}
 		return
@@ -126,41 +515,144 @@ func setField(t reflect.StructField, v reflect.Value, value string) (err error)
 	// If the given type is a slice, create a slice and return,
 	// otherwise, we're dealing with a primitive type
 	if v.Kind() == reflect.Slice {
-		return setSlice(t, v, value)
+		if err = setSlice(t, v, value, o); err != nil {
+			return
+		}
+		return checkUnique(t, v, o)
+	}
+
+	// Maps with an empty struct value are treated as sets.
+	if isSet(v.Type()) {
+		return setSet(t, v, value, o)
+	}
+
+	if value, err = stripGroupSeparators(t, v, value); err != nil {
+		return
 	}
 
-	if err = setBuiltInField(v, value); err != nil {
+	if err = checkPattern(t, value, o); err != nil {
+		return
+	}
+
+	// Relative paths are resolved against the base directory.
+	if value, err = resolvePath(t, v, value, o); err != nil {
+		return
+	}
+
+	if names, ok := lookupEnum(v.Type()); ok {
+		err = setEnum(v, value, names)
+	} else if flagTag, ok := t.Tag.Lookup("flag_values"); ok {
+		err = setFlags(t, v, value, flagTag, o)
+	} else if tryTag, ok := t.Tag.Lookup("try"); ok {
+		err = setTry(v, value, tryTag)
+	} else if unitTag, ok := t.Tag.Lookup("unit"); ok {
+		err = setUnit(v, value, unitTag)
+	} else if formatTag, ok := t.Tag.Lookup("duration_format"); ok {
+		err = setDurationFormat(v, value, formatTag)
+	} else {
+		err = o.setBuiltInField(v, value)
+	}
+	if err != nil {
 		return fmt.Errorf("error setting %q: %v", t.Name, err)
 	}
 
-	return
+	if err = checkDuration(t, v, o); err != nil {
+		return
+	}
+
+	return checkConstraints(t, v, o)
+}
+
+// hasCodeDefault returns whether the field holds a value assigned in
+// code.  As false is the zero value of a bool, a false bool is only
+// treated as having been assigned if there's no default tag for it to
+// be told apart from.
+func hasCodeDefault(t reflect.StructField, v reflect.Value) bool {
+	if v.Kind() == reflect.Bool && !v.Bool() {
+		_, ok := t.Tag.Lookup("default")
+		return !ok
+	}
+	return !isZero(v)
+}
+
+// firstChoice returns the first of the field's choices, to be used
+// as its default if it is tagged with `default_first:"true"`.
+func firstChoice(t reflect.StructField, o *options) (string, bool, error) {
+	first, err := boolTag(t, "default_first")
+	if err != nil || !first {
+		return "", false, err
+	}
+
+	choices := split(t.Tag.Get("choices"), getDelimiter(t, o))
+	if len(choices) == 0 {
+		return "", false, fmt.Errorf("default_first tag of %q has no effect without a choices tag", t.Name)
+	}
+	return choices[0], true, nil
+}
+
+// setterTarget returns a freshly initialised value on which to invoke
+// Set, if the field implements the Setter or ContextSetter interface.
+// Pointer fields are assigned a newly allocated pointee, while value
+// fields whose pointer receiver implements either interface are reset
+// and addressed in place.
+func setterTarget(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() == reflect.Ptr {
+		if isSetter(v.Interface()) {
+			v.Set(reflect.New(v.Type().Elem()))
+			return v, true
+		}
+		return reflect.Value{}, false
+	}
+
+	if v.CanAddr() {
+		if isSetter(v.Addr().Interface()) {
+			v.Set(reflect.Zero(v.Type()))
+			return v.Addr(), true
+		}
+	}
+	return reflect.Value{}, false
 }
 
 // ProcessMissing returns an error if a required tag is found
-// and is set to true.  A different error will be returned if
+// and is set to true, or if there is no required tag and the
+// required policy deems the field to be required.  The error
+// includes the field's example, if it has one.  A different error will be returned if
 // the required tag was present but the value could not be parsed
 // to a Boolean value.
-func processMissing(t reflect.StructField, envTag string, ct configType) (err error) {
-	reqTag, ok := t.Tag.Lookup("required")
-	if !ok {
-		// No required tag was found, this field doesn't expect
-		// an env tag to be provided.
-		return nil
-	}
-
+func processMissing(t reflect.StructField, envTag string, ct configType, o *options) (err error) {
 	var b bool
-	if b, err = strconv.ParseBool(reqTag); err != nil {
-		// The value provided for the required tag is not a valid
-		// Boolean, so inform the user.
-		return fmt.Errorf("invalid required tag %q: %v", reqTag, err)
+	if b, err = isRequired(t, envTag, o); err != nil {
+		return
 	}
 
 	if b {
-		// The value provided for the required tag is valid and is
-		// set to true, so the user needs to know that a required
-		// environment variable could not be found.
-		return fmt.Errorf("%s %s configuration was missing", envTag, ct)
+		// The field is required, so the user needs to know that a
+		// required environment variable could not be found.
+		err = fmt.Errorf("%s %s configuration was missing%s", envTag, ct, exampleSuffix(t))
+		if o.missing != nil {
+			*o.missing = append(*o.missing, missingField{name: envTag, err: err})
+			return nil
+		}
 	}
 
 	return
 }
+
+// isRequired returns whether the field is required, according to its
+// required tag or, if it has none, the required policy.
+func isRequired(t reflect.StructField, envTag string, o *options) (bool, error) {
+	reqTag, ok := t.Tag.Lookup("required")
+	if !ok {
+		// No required tag was found, so defer to the required
+		// policy, if one was provided.
+		return o.requiredPolicy != nil && o.requiredPolicy(t.Name, envTag), nil
+	}
+
+	b, err := strconv.ParseBool(reqTag)
+	if err != nil {
+		// The value provided for the required tag is not a valid
+		// Boolean, so inform the user.
+		return false, fmt.Errorf("invalid required tag %q: %v", reqTag, err)
+	}
+	return b, nil
+}
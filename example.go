@@ -0,0 +1,28 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// exampleSuffix returns the "example" tag of the field formatted for
+// appending to an error, such as " (example: 8080)", or nothing if the
+// field has no example.  Examples are omitted for secret fields, so an
+// error never implies what a real secret looks like.
+func exampleSuffix(t reflect.StructField) string {
+	example, ok := t.Tag.Lookup("example")
+	if !ok || isSecret(t) {
+		return ""
+	}
+	return fmt.Sprintf(" (example: %s)", example)
+}
+
+// withExample appends the field's example, if any, to an error caused
+// by a missing or invalid value.
+func withExample(t reflect.StructField, err error) error {
+	suffix := exampleSuffix(t)
+	if err == nil || suffix == "" {
+		return err
+	}
+	return fmt.Errorf("%v%s", err, suffix)
+}
@@ -0,0 +1,63 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// setFlags sets an integer field to the bitwise OR of the values of
+// each of the named flags in the given value.  The flag names and
+// values are taken from the field's "flag_values" tag, in the form
+// "name=value[,name=value...]".
+//
+// Unknown flags result in an error, unless the field is tagged with
+// `unknown_flags:"ignore"`, in which case they are skipped.
+func setFlags(t reflect.StructField, v reflect.Value, value string, flagTag string, o *options) (err error) {
+	var names []string
+	flags := map[string]uint64{}
+	for _, pair := range split(flagTag, ",") {
+		kvp := strings.SplitN(pair, "=", 2)
+		if len(kvp) != 2 {
+			return fmt.Errorf("invalid flag_values tag %q: expected 'name=value'", flagTag)
+		}
+
+		name := strings.TrimSpace(kvp[0])
+		if flags[name], err = strconv.ParseUint(strings.TrimSpace(kvp[1]), 0, 64); err != nil {
+			return fmt.Errorf("invalid flag_values tag %q: %v", flagTag, err)
+		}
+		names = append(names, name)
+	}
+
+	ignoreUnknown := false
+	switch mode := t.Tag.Get("unknown_flags"); mode {
+	case "", "error":
+	case "ignore":
+		ignoreUnknown = true
+	default:
+		return fmt.Errorf("invalid unknown_flags tag %q: expected 'error' or 'ignore'", mode)
+	}
+
+	var result uint64
+	for _, token := range split(value, getDelimiter(t, nil)) {
+		flag, ok := flags[token]
+		if !ok {
+			if ignoreUnknown {
+				continue
+			}
+			return fmt.Errorf("unknown flag %q, expected one of %s", redact(t, token, o), strings.Join(names, ", "))
+		}
+		result |= flag
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(result))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(result)
+	default:
+		return fmt.Errorf("flag_values tag is not supported for %s", v.Kind())
+	}
+	return
+}
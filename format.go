@@ -0,0 +1,206 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	discriminatedMu    sync.RWMutex
+	discriminatedTypes = map[reflect.Type]map[string]reflect.Type{}
+)
+
+// RegisterDiscriminated registers a concrete type to be decoded into
+// an interface field with a "discriminator" tag, when the JSON value
+// of the discriminator key equals name.  The iface argument must be a
+// nil pointer to the interface type, for example (*Backend)(nil), and
+// concrete (or a pointer to it) must implement the interface.
+func RegisterDiscriminated(iface interface{}, name string, concrete interface{}) {
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Ptr || it.Elem().Kind() != reflect.Interface {
+		panic("env: RegisterDiscriminated requires a pointer to an interface")
+	}
+	it = it.Elem()
+
+	ct := reflect.TypeOf(concrete)
+	if !ct.Implements(it) && !reflect.PtrTo(ct).Implements(it) {
+		panic(fmt.Sprintf("env: %v does not implement %v", ct, it))
+	}
+
+	discriminatedMu.Lock()
+	defer discriminatedMu.Unlock()
+
+	if discriminatedTypes[it] == nil {
+		discriminatedTypes[it] = map[string]reflect.Type{}
+	}
+	discriminatedTypes[it][name] = ct
+}
+
+// setFormatted decodes the value according to the field's "format"
+// tag.
+func setFormatted(t reflect.StructField, v reflect.Value, value string, format string, o *options) (err error) {
+	switch format {
+	case "json":
+		err = setJSON(t, v, value, o)
+	case "positional":
+		err = setPositional(t, v, value, o)
+	default:
+		return fmt.Errorf("invalid format tag %q: expected 'json' or 'positional'", format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error setting %q: %v", t.Name, err)
+	}
+	return
+}
+
+// validateDecoded walks a value decoded from JSON, enforcing the
+// "required" and "choices" tags of any structs it contains, as JSON
+// decoding alone ignores them.  A required field is considered
+// missing if it decoded to its zero value.  Errors are reported with
+// the path to the offending field, such as "Rules[1].Action", and
+// with each offending value passed through mask.
+func validateDecoded(v reflect.Value, path string, mask func(string) string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return validateDecoded(v.Elem(), path, mask)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateDecoded(v.Index(i), fmt.Sprintf("%s[%d]", path, i), mask); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if err := validateDecoded(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, mask(fmt.Sprint(k.Interface()))), mask); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f, fv := v.Type().Field(i), v.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			fieldPath := path + "." + f.Name
+
+			if required, _ := strconv.ParseBool(f.Tag.Get("required")); required && isZero(fv) {
+				return fmt.Errorf("%s is required", fieldPath)
+			}
+
+			if choices, ok := f.Tag.Lookup("choices"); ok && !isZero(fv) {
+				if !validChoice(choices, renderDecoded(fv, getDelimiter(f, nil)), getDelimiter(f, nil)) {
+					return fmt.Errorf("value of %s is '%s', but not a set or subset of '%s'", fieldPath, mask(renderDecoded(fv, getDelimiter(f, nil))), choices)
+				}
+			}
+
+			if err := validateDecoded(fv, fieldPath, mask); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderDecoded renders a decoded value as it would have been given
+// in an environment variable, so that it can be checked against the
+// choices of the field.
+func renderDecoded(v reflect.Value, delimiter string) string {
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(values, delimiter)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// setPositional sets each of the exported fields of a struct, in
+// order of declaration, from the delimited values.
+func setPositional(t reflect.StructField, v reflect.Value, value string, o *options) (err error) {
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("positional format is not supported for %v", v.Type())
+	}
+
+	values := split(value, getDelimiter(t, nil))
+	if n := exportedFields(v); len(values) != n {
+		return fmt.Errorf("expected %d values, got %d", n, len(values))
+	}
+
+	return redactElements(t, setStructFields(v, values), o, values...)
+}
+
+func setJSON(t reflect.StructField, v reflect.Value, value string, o *options) (err error) {
+	mask := func(s string) string { return redact(t, s, o) }
+
+	key, ok := t.Tag.Lookup("discriminator")
+	if !ok {
+		instance := reflect.New(v.Type())
+		if err = json.Unmarshal([]byte(value), instance.Interface()); err != nil {
+			return
+		}
+		if err = validateDecoded(instance.Elem(), t.Name, mask); err != nil {
+			return
+		}
+		v.Set(instance.Elem())
+		return
+	}
+
+	if v.Kind() != reflect.Interface {
+		return fmt.Errorf("discriminator tag is not supported for %v", v.Type())
+	}
+
+	var probe map[string]json.RawMessage
+	if err = json.Unmarshal([]byte(value), &probe); err != nil {
+		return
+	}
+
+	var name string
+	if raw, ok := probe[key]; !ok {
+		return fmt.Errorf("missing discriminator %q", key)
+	} else if err = json.Unmarshal(raw, &name); err != nil {
+		return fmt.Errorf("discriminator %q is not a string", key)
+	}
+
+	discriminatedMu.RLock()
+	types := discriminatedTypes[v.Type()]
+	concrete, ok := types[name]
+	var known []string
+	for k := range types {
+		known = append(known, k)
+	}
+	discriminatedMu.RUnlock()
+
+	if !ok {
+		sort.Strings(known)
+		return fmt.Errorf("unknown %s %q, expected one of %s", key, mask(name), strings.Join(known, ", "))
+	}
+
+	instance := reflect.New(concrete)
+	if err = json.Unmarshal([]byte(value), instance.Interface()); err != nil {
+		return
+	}
+	if err = validateDecoded(instance.Elem(), t.Name, mask); err != nil {
+		return
+	}
+
+	if concrete.Implements(v.Type()) {
+		v.Set(instance.Elem())
+	} else {
+		v.Set(instance)
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package env
+
+import (
+	"reflect"
+	"strings"
+)
+
+// isHeadTail returns whether the field is tagged with `head:"true"`
+// or a "tail" tag, so that both split the value on the same
+// delimiter, whatever their types.
+func isHeadTail(t reflect.StructField) bool {
+	head, _ := boolTag(t, "head")
+	_, tail := t.Tag.Lookup("tail")
+	return head || tail
+}
+
+// headTail returns the part of a value used by a field tagged with
+// `head:"true"`, which is the first token of the value, or with a
+// "tail" tag, which is every token after the first, re-joined with
+// the delimiter.  Other fields use the whole value.  False is
+// returned if there is nothing left for a tail field to use.
+func headTail(t reflect.StructField, value string, o *options) (string, bool, error) {
+	head, err := boolTag(t, "head")
+	if err != nil {
+		return "", false, err
+	}
+	_, tail := t.Tag.Lookup("tail")
+	if !head && !tail {
+		return value, true, nil
+	}
+
+	delimiter := getDelimiter(t, o)
+	tokens := split(value, delimiter)
+	if head {
+		if len(tokens) == 0 {
+			return "", true, nil
+		}
+		return tokens[0], true, nil
+	}
+
+	if len(tokens) < 2 {
+		return "", false, nil
+	}
+	return strings.Join(tokens[1:], delimiter), true, nil
+}
@@ -0,0 +1,172 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// processIndexed sets a slice field tagged `indexed_scalar:"true"`
+// from the environment variables NAME_0, NAME_1 and so on, stopping
+// at the first missing index.  If the field is also tagged with
+// `strict_index:"true"`, a gap in the indices results in an error
+// rather than silently truncating the slice.
+//
+// Returns false if the field isn't indexed, or if no indexed
+// environment variables were found.
+func processIndexed(t reflect.StructField, v reflect.Value, envTag string, o *options) (found bool, err error) {
+	indexed, err := boolTag(t, "indexed_scalar")
+	if err != nil || !indexed {
+		return
+	}
+	if v.Kind() != reflect.Slice {
+		return false, fmt.Errorf("indexed_scalar tag is not supported for %v", v.Type())
+	}
+
+	var values []string
+	for i := 0; ; i++ {
+		value, ok, lerr := o.lookup(indexedName(envTag, i))
+		if lerr != nil {
+			return false, lerr
+		}
+		if !ok {
+			break
+		}
+		values = append(values, value)
+	}
+
+	strict, err := boolTag(t, "strict_index")
+	if err != nil {
+		return
+	}
+	if strict {
+		if max := maxIndex(envTag, o.environ()); max >= len(values) {
+			return false, fmt.Errorf("%s %s configuration was missing, but %s was found", indexedName(envTag, len(values)), configTypeEnvironment, indexedName(envTag, max))
+		}
+	}
+
+	if len(values) == 0 {
+		return
+	}
+	if o.presenceOnly {
+		o.resolved[t.Tag.Get("env")] = strings.Join(values, getDelimiter(t, o))
+		return true, nil
+	}
+
+	sliceValue := reflect.MakeSlice(v.Type(), len(values), len(values))
+	for i, value := range values {
+		if err = setBuiltInField(sliceValue.Index(i), value); err != nil {
+			return false, redactElements(t, fmt.Errorf("error setting %q: %s: %v", t.Name, indexedName(envTag, i), err), o, value)
+		}
+	}
+
+	v.Set(sliceValue)
+	o.resolved[t.Tag.Get("env")] = strings.Join(values, getDelimiter(t, o))
+	return true, nil
+}
+
+// processIndexedStructs sets a slice of structs tagged with
+// `indexed_struct:"true"` from groups of environment variables such as
+// NAME_0_HOST and NAME_0_PORT, one struct per index.  Each struct's
+// fields are set just as the fields of a top-level struct are, with
+// the environment variables prefixed by NAME_<index>_, so their
+// "required", "default" and "choices" tags all apply.  Indices are
+// read from 0, stopping at the first missing index, unless the field
+// is tagged with `strict_index:"true"`, in which case a gap results
+// in an error.
+//
+// Returns false if the field isn't indexed, or if no indexed
+// environment variables were found.
+func processIndexedStructs(t reflect.StructField, v reflect.Value, envTag string, o *options) (found bool, err error) {
+	indexed, err := boolTag(t, "indexed_struct")
+	if err != nil || !indexed {
+		return
+	}
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return false, fmt.Errorf("indexed_struct tag is not supported for %v", v.Type())
+	}
+
+	indices := structIndices(envTag, o.environ())
+	n := 0
+	for indices[n] {
+		n++
+	}
+
+	strict, err := boolTag(t, "strict_index")
+	if err != nil {
+		return
+	}
+	if strict && len(indices) > n {
+		return false, fmt.Errorf("%s_* %s configuration was missing, but other indices were found", indexedName(envTag, n), configTypeEnvironment)
+	}
+
+	if n == 0 {
+		return
+	}
+
+	// The element prefix is built from the name before it was
+	// rewritten, as the rewriter is applied to each element's keys.
+	name := o.prefixed(t, t.Tag.Get("env"))
+
+	sliceValue := reflect.MakeSlice(v.Type(), n, n)
+	for i := 0; i < n; i++ {
+		elem := *o
+		elem.prefix = indexedName(name, i) + "_"
+		elem.resolved = map[string]string{}
+
+		element := sliceValue.Index(i)
+		for j := 0; j < element.NumField(); j++ {
+			if err = processField(element.Type().Field(j), element.Field(j), &elem); err != nil {
+				return false, fmt.Errorf("error setting %q: element %d: %v", t.Name, i, err)
+			}
+		}
+
+		// Template fields and fields with default funcs are set once
+		// all other fields have been, along with those of the parent.
+		o.templates = elem.templates
+		o.defaultFuncs = elem.defaultFuncs
+	}
+
+	v.Set(sliceValue)
+	return true, nil
+}
+
+// structIndices returns the indices of the environment variables
+// named NAME_<index>_*.
+func structIndices(envTag string, names []string) map[int]bool {
+	indices := map[int]bool{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, envTag+"_") {
+			continue
+		}
+		rest := name[len(envTag)+1:]
+		sep := strings.Index(rest, "_")
+		if sep < 0 {
+			continue
+		}
+		if i, err := strconv.Atoi(rest[:sep]); err == nil && i >= 0 {
+			indices[i] = true
+		}
+	}
+	return indices
+}
+
+func indexedName(envTag string, i int) string {
+	return envTag + "_" + strconv.Itoa(i)
+}
+
+// maxIndex returns the highest index of the environment variables
+// that match the indexed name, or -1 if there are none.
+func maxIndex(envTag string, names []string) int {
+	max := -1
+	for _, name := range names {
+		if !strings.HasPrefix(name, envTag+"_") {
+			continue
+		}
+		if i, err := strconv.Atoi(name[len(envTag)+1:]); err == nil && i > max {
+			max = i
+		}
+	}
+	return max
+}
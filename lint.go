@@ -0,0 +1,115 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// boolTags are the tags whose values must be Booleans.
+var boolTags = []string{
+	"required", "secret", "encrypted", "template", "nonneg", "clamp",
+	"indexed_scalar", "strict_index", "no_prefix", "group_sep", "weighted",
+	"allow_empty", "unique", "default_first", "oneof", "path",
+}
+
+// modifierTags are tags that have no effect without another tag, or
+// any one of several tags separated by "|".
+var modifierTags = [][2]string{
+	{"strict_index", "indexed_scalar|indexed_struct"},
+	{"unknown_flags", "flag_values"},
+	{"clamp", "nonneg|precision"},
+	{"discriminator", "format"},
+	{"default_first", "choices"},
+}
+
+// Lint reports combinations of tags that don't make sense, such as
+// a required field with a default, or a default that isn't one of
+// the field's choices.  Only the struct's tags are inspected; its
+// values and the environment are ignored.
+func Lint(i interface{}) []string {
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return []string{fmt.Sprintf("%v is not a struct", t)}
+	}
+
+	var problems []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup("env"); !ok {
+			continue
+		}
+
+		report := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Sprintf("%s: %s", f.Name, fmt.Sprintf(format, args...)))
+		}
+
+		for _, name := range boolTags {
+			if tag, ok := f.Tag.Lookup(name); ok {
+				if _, err := strconv.ParseBool(tag); err != nil {
+					report("%s tag %q is not a Boolean", name, tag)
+				}
+			}
+		}
+
+		for _, m := range modifierTags {
+			if _, hasModifier := f.Tag.Lookup(m[0]); !hasModifier {
+				continue
+			}
+			bases := strings.Split(m[1], "|")
+			hasBase := false
+			for _, base := range bases {
+				if _, ok := f.Tag.Lookup(base); ok {
+					hasBase = true
+				}
+			}
+			if !hasBase {
+				report("%s tag has no effect without a %s tag", m[0], strings.Join(bases, " or "))
+			}
+		}
+
+		d, hasDefault := f.Tag.Lookup("default")
+		if required, _ := strconv.ParseBool(f.Tag.Get("required")); required && hasDefault {
+			report("required tag has no effect when a default is provided")
+		}
+
+		// Default funcs can only be checked once they have run.
+		_, isFunc := defaultFuncName(d)
+		if choices, ok := f.Tag.Lookup("choices"); ok && hasDefault && !isFunc {
+			var valid bool
+			if hasParsedChoices(f) {
+				_, err := checkNumericChoice(f, choices, d, nil)
+				valid = err == nil
+			} else {
+				valid = validChoice(choices, d, getDelimiter(f, nil))
+			}
+			if !valid {
+				report("default %q is not one of the choices %q", d, choices)
+			}
+		}
+
+		if tag, ok := f.Tag.Lookup("constraint"); ok {
+			for _, name := range split(tag, ",") {
+				if _, ok := constraints[name]; !ok {
+					report("unknown constraint %q", name)
+				}
+			}
+		}
+
+		if order, ok := f.Tag.Lookup("sort"); ok && order != "asc" && order != "desc" {
+			report("sort tag %q must be 'asc' or 'desc'", order)
+		}
+
+		if tag, ok := f.Tag.Lookup("requires"); ok {
+			if _, err := parseRequires(tag); err != nil {
+				report("%v", err)
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,275 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Lookuper looks up configuration values by name, allowing sources
+// other than the environment to be used.  If a Lookuper also has a
+// Keys() []string method, it is used wherever the names of all of
+// the available values need to be discovered.
+type Lookuper interface {
+	Lookup(key string) (string, bool)
+}
+
+// LookuperFunc adapts an ordinary function to a Lookuper.
+type LookuperFunc func(key string) (string, bool)
+
+// Lookup calls f(key).
+func (f LookuperFunc) Lookup(key string) (string, bool) {
+	return f(key)
+}
+
+// overrideLookuper looks up values from a map, falling through to
+// the environment for keys that aren't in it.
+type overrideLookuper map[string]string
+
+func (l overrideLookuper) Lookup(key string) (string, bool) {
+	if value, ok := l[key]; ok {
+		return value, true
+	}
+	return os.LookupEnv(key)
+}
+
+func (l overrideLookuper) Keys() []string {
+	var names []string
+	for _, e := range os.Environ() {
+		name := strings.SplitN(e, "=", 2)[0]
+		if _, ok := l[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range l {
+		names = append(names, name)
+	}
+	return names
+}
+
+// mapLookuper looks up values from a map alone.
+type mapLookuper map[string]string
+
+func (l mapLookuper) Lookup(key string) (string, bool) {
+	value, ok := l[key]
+	return value, ok
+}
+
+func (l mapLookuper) Keys() []string {
+	var names []string
+	for name := range l {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ContextLookuper is a Lookuper for sources that may block, such as
+// remote secret stores, which should stop looking up a value when
+// the given context is done.
+type ContextLookuper interface {
+	LookupContext(ctx context.Context, key string) (string, bool, error)
+}
+
+// Environment is a Lookuper for the environment, which is the source
+// values are looked up from by default.
+var Environment Lookuper = environmentLookuper{}
+
+type environmentLookuper struct{}
+
+func (environmentLookuper) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+func (environmentLookuper) Keys() []string {
+	var names []string
+	for _, e := range os.Environ() {
+		names = append(names, strings.SplitN(e, "=", 2)[0])
+	}
+	return names
+}
+
+// Layer is a source of values consulted by SetLayered, along with the
+// prefix prepended to the name of each value looked up from it.
+type Layer struct {
+	// Name identifies the layer as the source of a value in a Result.
+	Name     string
+	Prefix   string
+	Lookuper Lookuper
+}
+
+// layerHit records the layer a value was found in, and the name it
+// was found under.
+type layerHit struct {
+	layer string
+	name  string
+}
+
+// WithLayers sets the sources that values are looked up from to the
+// given layers, each of which is consulted in order.  The first layer
+// with a non-empty value for the prefixed name wins.
+func WithLayers(layers ...Layer) Option {
+	return func(o *options) {
+		o.layers = layers
+		o.lookuper = nil
+		o.contextLookuper = nil
+	}
+}
+
+// WithLookuper sets the source that values are looked up from.  By
+// default, values are looked up from the environment.
+func WithLookuper(l Lookuper) Option {
+	return func(o *options) {
+		o.lookuper = l
+		o.contextLookuper = nil
+		o.layers = nil
+	}
+}
+
+// WithContextLookuper sets a context-aware source that values are
+// looked up from.
+func WithContextLookuper(l ContextLookuper) Option {
+	return func(o *options) {
+		o.contextLookuper = l
+		o.lookuper = nil
+		o.layers = nil
+	}
+}
+
+// WithLookupTimeout sets the maximum time a ContextLookuper may take
+// to look up a single value.  A lookup that times out is treated as
+// missing, so the field's "default" and "required" tags apply, and a
+// warning is raised.
+func WithLookupTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.lookupTimeout = d
+	}
+}
+
+// WithAllowedKeys restricts the values that may be looked up to
+// those with the given keys.  Fields whose keys are not allowed are
+// treated as missing, so their "default" and "required" tags apply,
+// and a warning is raised.
+func WithAllowedKeys(keys []string) Option {
+	return func(o *options) {
+		o.allowedKeys = map[string]bool{}
+		for _, k := range keys {
+			o.allowedKeys[k] = true
+		}
+	}
+}
+
+// lookup returns the value of the given key from the configured
+// source and whether it was present.
+func (o *options) lookup(key string) (string, bool, error) {
+	if o.defaultsOnly {
+		return "", false, nil
+	}
+
+	if o.allowedKeys != nil && !o.allowedKeys[key] {
+		o.warn("%s is not an allowed key and has been treated as missing", key)
+		return "", false, nil
+	}
+
+	if o.layers != nil {
+		value, ok := o.lookupLayers(key)
+		return value, ok, nil
+	}
+
+	if o.contextLookuper != nil {
+		return o.lookupContext(key)
+	}
+
+	if o.lookuper != nil {
+		value, ok := o.lookuper.Lookup(key)
+		return value, ok, nil
+	}
+
+	value, ok := os.LookupEnv(key)
+	return value, ok, nil
+}
+
+// lookupLayers returns the first non-empty value for the key from the
+// layers, recording the layer it was found in.  If no layer has a
+// non-empty value, the key is present if any layer has it.
+func (o *options) lookupLayers(key string) (string, bool) {
+	var present bool
+	for _, l := range o.layers {
+		name := l.Prefix + key
+		value, ok := l.Lookuper.Lookup(name)
+		if ok && value != "" {
+			o.layerHits[key] = layerHit{layer: l.Name, name: name}
+			return value, true
+		}
+		present = present || ok
+	}
+	return "", present
+}
+
+func (o *options) lookupContext(key string) (string, bool, error) {
+	ctx := o.ctx
+	if o.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.lookupTimeout)
+		defer cancel()
+	}
+
+	value, ok, err := o.contextLookuper.LookupContext(ctx, key)
+	if err == nil {
+		return value, ok, nil
+	}
+
+	// Only a timeout of this individual lookup is treated as a
+	// missing value, any other error is returned.
+	if o.lookupTimeout > 0 && ctx.Err() == context.DeadlineExceeded && o.ctx.Err() == nil {
+		o.warn("lookup of %s timed out after %v", key, o.lookupTimeout)
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("error looking up %s: %v", key, err)
+}
+
+// environ returns the names of all of the available values.
+func (o *options) environ() []string {
+	if o.defaultsOnly {
+		return nil
+	}
+
+	var allowed []string
+	for _, name := range o.allKeys() {
+		if o.allowedKeys == nil || o.allowedKeys[name] {
+			allowed = append(allowed, name)
+		}
+	}
+	return allowed
+}
+
+func (o *options) allKeys() []string {
+	if o.layers != nil {
+		var names []string
+		for _, l := range o.layers {
+			k, ok := l.Lookuper.(interface{ Keys() []string })
+			if !ok {
+				continue
+			}
+			for _, name := range k.Keys() {
+				if strings.HasPrefix(name, l.Prefix) {
+					names = append(names, name[len(l.Prefix):])
+				}
+			}
+		}
+		return names
+	}
+
+	var source interface{} = o.lookuper
+	if o.contextLookuper != nil {
+		source = o.contextLookuper
+	}
+	if source != nil {
+		if k, ok := source.(interface{ Keys() []string }); ok {
+			return k.Keys()
+		}
+		return nil
+	}
+	return environmentLookuper{}.Keys()
+}
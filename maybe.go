@@ -0,0 +1,32 @@
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaybeDuration is a Setter for settings that can be disabled, enabled
+// or enabled with an interval, such as a health check.  "false"
+// disables it, "true" enables it with an Interval of zero, leaving
+// the caller to choose its own default, and a duration such as "30s"
+// enables it with that Interval.
+type MaybeDuration struct {
+	Enabled  bool
+	Interval time.Duration
+}
+
+// Set parses the value as a Boolean or a duration.
+func (d *MaybeDuration) Set(value string) error {
+	if b, err := strconv.ParseBool(value); err == nil {
+		*d = MaybeDuration{Enabled: b}
+		return nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%q is neither a Boolean nor a duration", value)
+	}
+	*d = MaybeDuration{Enabled: true, Interval: interval}
+	return nil
+}
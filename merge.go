@@ -0,0 +1,90 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// processMerge sets a slice field tagged with a "merge" tag, such as
+// `merge:"PATH_BASE,PATH_EXTRA_*"`, from the concatenated elements of
+// each of the listed environment variables, in the order they are
+// listed.  A listed name may contain a single "*" wildcard, in which
+// case every matching environment variable is included, ordered by
+// the text captured by the wildcard, numerically if it's a number.
+// If none of the environment variables are found, the field's
+// "default" and "required" tags apply.
+func processMerge(t reflect.StructField, v reflect.Value, mergeTag string, o *options) (err error) {
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("merge tag is not supported for %v", v.Type())
+	}
+
+	delimiter := getDelimiter(t, o)
+
+	var values []string
+	for _, source := range strings.Split(mergeTag, ",") {
+		key := o.key(t, strings.TrimSpace(source))
+
+		names := []string{key}
+		if strings.Contains(key, "*") {
+			names = mergeNames(key, o)
+		}
+
+		for _, name := range names {
+			value, ok, lerr := o.lookup(name)
+			if lerr != nil {
+				return lerr
+			}
+			if ok && value != "" {
+				values = append(values, split(value, delimiter)...)
+				o.source(name, sourceEnvironment)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		if d, ok := t.Tag.Lookup("default"); ok {
+			o.source(mergeTag, sourceDefault)
+			if o.presenceOnly {
+				return
+			}
+			return assign(t, v, d, o)
+		}
+		if o.defaultsOnly {
+			v.Set(reflect.Zero(t.Type))
+			return
+		}
+		return processMissing(t, mergeTag, configTypeEnvironment, o)
+	}
+
+	value := strings.Join(values, delimiter)
+	o.resolved[mergeTag] = value
+	if o.presenceOnly {
+		return
+	}
+	return assign(t, v, value, o)
+}
+
+// mergeNames returns the names of the environment variables matching
+// the wildcard key, ordered by the text captured by the wildcard.
+// Captures that are both numbers are compared numerically, so that
+// PATH_EXTRA_2 comes before PATH_EXTRA_10.
+func mergeNames(key string, o *options) []string {
+	captures, matches := matchWildcard(key, o)
+	sort.SliceStable(captures, func(i, j int) bool {
+		a, aerr := strconv.Atoi(captures[i])
+		b, berr := strconv.Atoi(captures[j])
+		if aerr == nil && berr == nil {
+			return a < b
+		}
+		return captures[i] < captures[j]
+	})
+
+	names := make([]string, len(captures))
+	for i, c := range captures {
+		names[i] = matches[c]
+	}
+	return names
+}
@@ -0,0 +1,74 @@
+package env
+
+import (
+	"reflect"
+)
+
+// missingField is a required field found to be missing, named by its
+// environment variable if it has one.
+type missingField struct {
+	name string
+	err  error
+}
+
+// MissingRequired returns the names of the environment variables
+// that are required but missing, without modifying the struct.  The
+// fields of a scratch copy of the struct are resolved just as Set
+// would resolve them, but without decrypting, transforming or
+// converting any values, so a field is missing exactly when Set would
+// report it missing: when it is tagged with `required:"true"` and has no
+// default, when the required policy deems it so, or when a "requires"
+// tag's condition holds.  This includes merge and tail fields, and
+// the required fields of the chosen sub-struct of a oneof field,
+// while an empty value for a field tagged `allow_empty:"true"` is
+// present.  Values are looked up from the source given by the
+// options, if any, and other errors are ignored.
+func MissingRequired(i interface{}, opts ...Option) []string {
+	t := reflect.TypeOf(i)
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	o := newOptions(opts)
+	o.result = &Result{Sources: map[string]string{}, Names: map[string]string{}}
+	var fields []missingField
+	o.missing = &fields
+	o.presenceOnly = true
+
+	v := reflect.New(t).Elem()
+	var rules []requiresRule
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag, ok := f.Tag.Lookup("requires"); ok {
+			if r, err := parseRequires(tag); err == nil {
+				r.resolveCondition(t)
+				rules = append(rules, r)
+			}
+		}
+		processField(f, v.Field(i), o)
+	}
+
+	seen := map[string]bool{}
+	var missing []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			missing = append(missing, name)
+		}
+	}
+	for _, f := range fields {
+		add(f.name)
+	}
+	for _, r := range rules {
+		for _, name := range r.missing(o.resolved) {
+			add(name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,93 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// processOneOf sets a struct field tagged with `oneof:"true"`, whose
+// fields are themselves structs, such as one per backend.  The fields
+// of each sub-struct are set as usual, recursing into any nested
+// oneof fields, and then exactly one of the sub-structs must be
+// configured, by having a value for one of its fields found in the
+// environment.  Required fields are only enforced for the sub-struct
+// that was chosen.
+func processOneOf(t reflect.StructField, v reflect.Value, tag string, o *options) error {
+	if b, err := strconv.ParseBool(tag); err != nil {
+		return fmt.Errorf("invalid oneof tag %q: %v", tag, err)
+	} else if !b {
+		return nil
+	}
+
+	if !v.CanSet() {
+		return fmt.Errorf("field '%s' cannot be set", t.Name)
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("oneof tag is not supported for %s", v.Kind())
+	}
+
+	var set []string
+	var missing []missingField
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+		if fv.Kind() != reflect.Struct {
+			return fmt.Errorf("oneof field '%s' must only contain structs, but '%s' is %s", t.Name, f.Name, fv.Kind())
+		}
+
+		// Missing required fields are collected rather than returned
+		// until it is known whether this sub-struct was chosen.
+		var subMissing []missingField
+		var found bool
+		sub := *o
+		sub.missing = &subMissing
+		sub.found = &found
+		for j := 0; j < fv.NumField(); j++ {
+			if err := checkContext(fv.Type().Field(j), o); err != nil {
+				return err
+			}
+			if err := processField(fv.Type().Field(j), fv.Field(j), &sub); err != nil {
+				return contextError(fv.Type().Field(j), err, o)
+			}
+		}
+		o.templates = sub.templates
+		o.defaultFuncs = sub.defaultFuncs
+
+		if found {
+			set = append(set, f.Name)
+			missing = subMissing
+			if o.found != nil {
+				*o.found = true
+			}
+		}
+	}
+
+	// When resetting to defaults, the environment isn't consulted, so
+	// none of the sub-structs can have been chosen.
+	if o.defaultsOnly {
+		return nil
+	}
+
+	var err error
+	switch len(set) {
+	case 1:
+		if o.missing != nil {
+			*o.missing = append(*o.missing, missing...)
+		} else if len(missing) > 0 {
+			err = missing[0].err
+		}
+	case 0:
+		err = fmt.Errorf("exactly one of the fields of '%s' must be configured, but none were", t.Name)
+	default:
+		err = fmt.Errorf("exactly one of the fields of '%s' must be configured, but %s were", t.Name, strings.Join(set, ", "))
+	}
+
+	// A oneof field nested in a sub-struct is only enforced if that
+	// sub-struct is chosen.
+	if err != nil && o.missing != nil {
+		*o.missing = append(*o.missing, missingField{err: err})
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,236 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Option configures the behaviour of a call to Set.
+type Option func(*options)
+
+// options holds the configuration for a single call to Set.
+type options struct {
+	decryptor func(string) (string, error)
+	redactor  func(string) string
+	warnings  func(string)
+
+	requiredPolicy func(field, envVar string) bool
+
+	schemaLoader SchemaLoader
+
+	lookuper        Lookuper
+	contextLookuper ContextLookuper
+	layers          []Layer
+	layerHits       map[string]layerHit
+	lookupTimeout   time.Duration
+	allowedKeys     map[string]bool
+	ctx             context.Context
+
+	prefix           string
+	keyRewriter      func(string) string
+	baseDir          string
+	nullTokens       []string
+	structDelimiter  string
+	validateDefaults bool
+	unquote          bool
+	codeDefaults     bool
+	parseCache       bool
+
+	// defaultsOnly causes the environment to be ignored, so that
+	// fields are only set from their "default" tags.
+	defaultsOnly bool
+
+	// validatingDefaults causes default funcs and template defaults
+	// to be skipped, as they can't be resolved against the scratch
+	// struct used to validate defaults.
+	validatingDefaults bool
+
+	// presenceOnly causes fields to be resolved without converting
+	// their values, so that MissingRequired only finds out which
+	// values are present.
+	presenceOnly bool
+
+	// resolved holds the values resolved during the call, keyed
+	// by environment variable name.
+	resolved map[string]string
+
+	// result collects the outcome of the call for Apply, and is nil
+	// for Set.
+	result *Result
+
+	// defaultFuncs holds the fields whose defaults will be produced
+	// by a default func once all other fields have been set.
+	defaultFuncs []pendingDefault
+
+	// templates holds the fields whose values will be rendered as
+	// templates once all other fields have been set.
+	templates []pendingTemplate
+
+	// missing collects the missing required fields, rather than
+	// returning errors for them, when it isn't nil.  This lets the
+	// required fields of a oneof sub-struct only be enforced if it is
+	// chosen, and MissingRequired share Set's notion of missing.
+	missing *[]missingField
+
+	// found is set to true whenever a value is taken from the
+	// environment, when it isn't nil, so that a oneof sub-struct is
+	// only chosen if one of its environment variables was found.
+	found *bool
+}
+
+// isNullToken returns whether the value is one of the null tokens.
+func (o *options) isNullToken(value string) bool {
+	for _, token := range o.nullTokens {
+		if value == token {
+			return true
+		}
+	}
+	return false
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		ctx:       context.Background(),
+		resolved:  map[string]string{},
+		layerHits: map[string]layerHit{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// key returns the name of the environment variable to look up for
+// the field, applying any prefix and then the key rewriter.
+func (o *options) key(t reflect.StructField, envTag string) string {
+	key := o.prefixed(t, envTag)
+	if o.keyRewriter != nil {
+		key = o.keyRewriter(key)
+	}
+	return key
+}
+
+// prefixed returns the name of the environment variable for the field
+// with any prefix applied, but before it has been rewritten.
+func (o *options) prefixed(t reflect.StructField, envTag string) string {
+	if noPrefix, _ := strconv.ParseBool(t.Tag.Get("no_prefix")); noPrefix {
+		return envTag
+	}
+	return o.prefix + envTag
+}
+
+// warn reports a non-fatal problem to the warning handler, if one
+// has been provided.
+func (o *options) warn(format string, args ...interface{}) {
+	if o.warnings != nil {
+		o.warnings(fmt.Sprintf(format, args...))
+	}
+}
+
+// WithWarningHandler registers a function to be called with each
+// warning raised while setting fields.  Warnings describe problems
+// that have been worked around rather than returned as errors.
+func WithWarningHandler(h func(warning string)) Option {
+	return func(o *options) {
+		o.warnings = h
+	}
+}
+
+// WithPrefix prepends the given prefix to the name of each
+// environment variable, unless the field is tagged with
+// `no_prefix:"true"`.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithDecryptor registers a function used to decrypt the values
+// of fields tagged with `encrypted:"true"`.  Fields without the
+// tag are passed through untouched.
+func WithDecryptor(d func(ciphertext string) (string, error)) Option {
+	return func(o *options) {
+		o.decryptor = d
+	}
+}
+
+// WithDefaultValidation causes Set to validate the "default" tag of
+// every field before setting any fields, as per ValidateDefaults.
+func WithDefaultValidation() Option {
+	return func(o *options) {
+		o.validateDefaults = true
+	}
+}
+
+// WithUnquote causes a single pair of matching double or single
+// quotes surrounding a value to be removed before it is processed.
+// For slices and sets, quotes are also removed from each element.
+func WithUnquote() Option {
+	return func(o *options) {
+		o.unquote = true
+	}
+}
+
+// WithRequiredPolicy registers a function that decides whether a
+// field without a "required" tag is required, given the field's name
+// and the name of its environment variable.  The policy is only
+// consulted when the environment variable is missing and the field
+// has no default.  A field's "required" tag always takes precedence.
+func WithRequiredPolicy(p func(field, envVar string) bool) Option {
+	return func(o *options) {
+		o.requiredPolicy = p
+	}
+}
+
+// WithCodeDefaults causes the values assigned to fields before Set is
+// called to be used as defaults, taking precedence over "default"
+// tags when an environment variable is missing.  Zero values are not
+// treated as defaults, except for false bools without a "default"
+// tag, which keep their value whenever their environment variable is
+// missing.
+func WithCodeDefaults() Option {
+	return func(o *options) {
+		o.codeDefaults = true
+	}
+}
+
+// DefaultNullTokens are the values commonly rendered by templating
+// systems in place of an absent value.
+var DefaultNullTokens = []string{"null", "<nil>", "nil"}
+
+// WithNullTokens causes a value that exactly matches one of the given
+// tokens to be treated as missing, so that the field's "default" and
+// "required" tags apply, and a warning to be raised.  Null tokens are
+// not checked unless this option is given, and passing no tokens
+// disables the check.  DefaultNullTokens holds the common tokens.
+func WithNullTokens(tokens []string) Option {
+	return func(o *options) {
+		o.nullTokens = tokens
+	}
+}
+
+// WithStructDelimiter sets the delimiter used by slice, set, head and
+// tail fields without a "delimiter" tag, in place of a comma.
+func WithStructDelimiter(delimiter string) Option {
+	return func(o *options) {
+		if token, ok := delimiterTokens[delimiter]; ok {
+			delimiter = token
+		}
+		o.structDelimiter = delimiter
+	}
+}
+
+// WithKeyRewriter registers a function that rewrites the name of each
+// environment variable before it is looked up, allowing arbitrary
+// naming schemes, such as reading APP__DB__HOST for `env:"DB.HOST"`.
+// The rewriter is given the name after any prefix has been applied,
+// and the rewritten name is the one reported in errors.  The names of
+// indexed environment variables are derived from the rewritten name.
+func WithKeyRewriter(r func(name string) string) Option {
+	return func(o *options) {
+		o.keyRewriter = r
+	}
+}
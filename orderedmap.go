@@ -0,0 +1,93 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// tagSetter is implemented by the Setters in this package that can
+// be configured by the tags of the field being set.  The field's
+// delimiter is resolved by the caller, as per getDelimiter.
+type tagSetter interface {
+	setTag(tag reflect.StructTag, delimiter string)
+}
+
+var tagSetterType = reflect.TypeOf((*tagSetter)(nil)).Elem()
+
+// OrderedMap is a Setter for key/value pairs, such as "a=1,b=2",
+// that preserves the order in which the keys were given.  Pairs are
+// separated by the field's delimiter, or the delimiter given to
+// WithStructDelimiter, falling back to a comma.
+//
+// Duplicate keys result in an error, unless the field is tagged
+// with `duplicates:"last"`, in which case the last value wins and the
+// key keeps the position it was first given in.
+type OrderedMap struct {
+	keys   []string
+	values map[string]string
+
+	delimiter  string
+	lastWins   bool
+	invalidTag string
+}
+
+func (m *OrderedMap) setTag(tag reflect.StructTag, delimiter string) {
+	m.delimiter = delimiter
+
+	switch d := tag.Get("duplicates"); d {
+	case "", "error":
+	case "last":
+		m.lastWins = true
+	default:
+		m.invalidTag = d
+	}
+}
+
+// Set parses the given key/value pairs.
+func (m *OrderedMap) Set(value string) error {
+	if m.invalidTag != "" {
+		return fmt.Errorf("invalid duplicates tag %q: expected 'error' or 'last'", m.invalidTag)
+	}
+
+	delimiter := m.delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+
+	m.keys = nil
+	m.values = map[string]string{}
+	for _, pair := range split(value, delimiter) {
+		kvp := strings.SplitN(pair, "=", 2)
+		if len(kvp) != 2 {
+			return fmt.Errorf("%q is not a key=value pair", pair)
+		}
+
+		k, v := strings.TrimSpace(kvp[0]), strings.TrimSpace(kvp[1])
+		if _, ok := m.values[k]; ok {
+			if !m.lastWins {
+				return fmt.Errorf("duplicate key %q", k)
+			}
+		} else {
+			m.keys = append(m.keys, k)
+		}
+		m.values[k] = v
+	}
+	return nil
+}
+
+// Get returns the value of the given key and whether it was present.
+func (m *OrderedMap) Get(key string) (string, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Keys returns the keys in the order they were given.
+func (m *OrderedMap) Keys() []string {
+	return append([]string(nil), m.keys...)
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
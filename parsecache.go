@@ -0,0 +1,68 @@
+package env
+
+import (
+	"reflect"
+	"sync"
+)
+
+// parseCacheSize bounds the number of conversions held by the parse
+// cache.
+const parseCacheSize = 4096
+
+type parseKey struct {
+	t   reflect.Type
+	raw string
+}
+
+var (
+	parseCacheMu sync.RWMutex
+	parseCache   = map[parseKey]reflect.Value{}
+)
+
+// WithParseCache causes the results of converting values to bool,
+// integer, unsigned integer, float and time.Duration fields and slice
+// elements to be cached, so that setting a struct repeatedly from mostly unchanged
+// values, such as when reloading, skips redundant parsing.  The cache
+// is shared by every call to Set with this option, safe for concurrent
+// use, and bounded in size.  Conversions that fail are not cached.
+func WithParseCache() Option {
+	return func(o *options) {
+		o.parseCache = true
+	}
+}
+
+// setBuiltInField sets the field as per setBuiltInField, using the
+// parse cache if enabled.
+func (o *options) setBuiltInField(v reflect.Value, value string) error {
+	if !o.parseCache || v.Kind() == reflect.String {
+		return setBuiltInField(v, value)
+	}
+
+	key := parseKey{t: v.Type(), raw: value}
+	parseCacheMu.RLock()
+	cached, ok := parseCache[key]
+	parseCacheMu.RUnlock()
+	if ok {
+		v.Set(cached)
+		return nil
+	}
+
+	if err := setBuiltInField(v, value); err != nil {
+		return err
+	}
+
+	parsed := reflect.New(v.Type()).Elem()
+	parsed.Set(v)
+
+	parseCacheMu.Lock()
+	defer parseCacheMu.Unlock()
+	if len(parseCache) >= parseCacheSize {
+		// Evict an arbitrary entry to make room.
+		for k := range parseCache {
+			delete(parseCache, k)
+			break
+		}
+	}
+	parseCache[key] = parsed
+	return nil
+}
@@ -0,0 +1,35 @@
+package env
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+)
+
+// WithBaseDir resolves the relative values of string fields tagged
+// with `path:"true"` against the given directory, such as the
+// directory of a configuration file, rather than the working
+// directory.  Relative values are joined to the directory and
+// cleaned, while absolute values are left unchanged.
+func WithBaseDir(dir string) Option {
+	return func(o *options) {
+		o.baseDir = dir
+	}
+}
+
+// resolvePath returns the value of a path field, resolved against
+// the base directory if it is relative.
+func resolvePath(t reflect.StructField, v reflect.Value, value string, o *options) (string, error) {
+	isPath, err := boolTag(t, "path")
+	if err != nil || !isPath {
+		return value, err
+	}
+	if v.Kind() != reflect.String {
+		return "", fmt.Errorf("path tag is not supported for %s", v.Kind())
+	}
+
+	if o.baseDir == "" || filepath.IsAbs(value) {
+		return value, nil
+	}
+	return filepath.Join(o.baseDir, value), nil
+}
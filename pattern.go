@@ -0,0 +1,53 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// compilePattern compiles the field's "pattern" tag, returning nil if
+// it has none.
+func compilePattern(t reflect.StructField) (*regexp.Regexp, error) {
+	tag, ok := t.Tag.Lookup("pattern")
+	if !ok {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(tag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern tag %q: %v", tag, err)
+	}
+	return re, nil
+}
+
+// checkPattern returns an error if the value doesn't match the
+// field's "pattern" tag.
+func checkPattern(t reflect.StructField, value string, o *options) error {
+	re, err := compilePattern(t)
+	if err != nil || re == nil {
+		return err
+	}
+
+	if !re.MatchString(value) {
+		return fmt.Errorf("value of '%s' is '%s', but does not match pattern '%s'", o.key(t, t.Tag.Get("env")), redact(t, value, o), re)
+	}
+	return nil
+}
+
+// checkElementPatterns returns an error for the first element of a
+// slice that doesn't match the field's "pattern" tag, which is
+// compiled once for all of the elements.
+func checkElementPatterns(t reflect.StructField, rawValues []string, o *options) error {
+	re, err := compilePattern(t)
+	if err != nil || re == nil {
+		return err
+	}
+
+	for i, value := range rawValues {
+		if !re.MatchString(value) {
+			return fmt.Errorf("element %d of '%s' is '%s', but does not match pattern '%s'", i, o.key(t, t.Tag.Get("env")), redact(t, value, o), re)
+		}
+	}
+	return nil
+}
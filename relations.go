@@ -0,0 +1,79 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// checkRelations validates the tags that describe relationships
+// between fields, once all of the fields have been set.
+func checkRelations(t reflect.Type, o *options) (err error) {
+	var rules []requiresRule
+	together := newGroups()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if tag, ok := f.Tag.Lookup("requires"); ok {
+			var r requiresRule
+			if r, err = parseRequires(tag); err != nil {
+				return
+			}
+			r.resolveCondition(t)
+			rules = append(rules, r)
+		}
+
+		if tag, ok := f.Tag.Lookup("together"); ok {
+			together.add(tag, f.Tag.Get("env"))
+		}
+	}
+
+	for _, r := range rules {
+		if err = r.check(o.resolved); err != nil {
+			return
+		}
+	}
+
+	return together.checkTogether(o.resolved)
+}
+
+// groups holds the environment variable names belonging to named
+// groups of fields, in declaration order.
+type groups struct {
+	names   []string
+	members map[string][]string
+}
+
+func newGroups() *groups {
+	return &groups{members: map[string][]string{}}
+}
+
+// add adds the environment variable to each of the comma-separated
+// groups in the given tag.
+func (g *groups) add(tag string, envTag string) {
+	for _, name := range split(tag, ",") {
+		if _, ok := g.members[name]; !ok {
+			g.names = append(g.names, name)
+		}
+		g.members[name] = append(g.members[name], envTag)
+	}
+}
+
+// checkTogether returns an error if any group has some, but not all,
+// of its members resolved to a value.
+func (g *groups) checkTogether(resolved map[string]string) error {
+	for _, name := range g.names {
+		var missing []string
+		for _, envTag := range g.members[name] {
+			if _, ok := resolved[envTag]; !ok {
+				missing = append(missing, envTag)
+			}
+		}
+
+		if len(missing) > 0 && len(missing) < len(g.members[name]) {
+			return fmt.Errorf("%s %s configuration was missing, but is required by other members of group '%s'", strings.Join(missing, ", "), configTypeEnvironment, name)
+		}
+	}
+	return nil
+}
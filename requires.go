@@ -0,0 +1,114 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// requiresRule is a simple implication parsed from a "requires"
+// tag, in the form "CONDITION => NAME[,NAME...]".  The condition
+// is either the name of an environment variable, which is satisfied
+// if the variable resolved to a value, or "NAME=value", which is
+// satisfied if the variable resolved to that value.  If the variable
+// is set to a bool or numeric field, the values are compared once
+// parsed, so "1" satisfies "TLS_ENABLED=true".
+type requiresRule struct {
+	raw      string
+	name     string
+	value    string
+	hasValue bool
+	required []string
+
+	// condType is the type of the field the condition's variable is
+	// set to, if it's one of the struct's fields.
+	condType reflect.Type
+}
+
+func parseRequires(tag string) (r requiresRule, err error) {
+	parts := strings.Split(tag, "=>")
+	if len(parts) != 2 {
+		return r, fmt.Errorf("invalid requires tag %q: expected 'CONDITION => NAME[,NAME...]'", tag)
+	}
+
+	r.raw = tag
+	condition := strings.TrimSpace(parts[0])
+	if i := strings.Index(condition, "="); i >= 0 {
+		r.name = strings.TrimSpace(condition[:i])
+		r.value = strings.TrimSpace(condition[i+1:])
+		r.hasValue = true
+	} else {
+		r.name = condition
+	}
+
+	r.required = split(parts[1], ",")
+	if r.name == "" || len(r.required) == 0 {
+		return r, fmt.Errorf("invalid requires tag %q: expected 'CONDITION => NAME[,NAME...]'", tag)
+	}
+
+	return
+}
+
+// resolveCondition records the type of the field that the rule's
+// condition refers to, among the fields of the given struct type.
+func (r *requiresRule) resolveCondition(t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("env") == r.name {
+			r.condType = f.Type
+			return
+		}
+	}
+}
+
+// holds returns whether the condition holds for the resolved value of
+// its variable.
+func (r requiresRule) holds(value string) bool {
+	if !r.hasValue {
+		return true
+	}
+
+	if r.condType != nil {
+		switch r.condType.Kind() {
+		case reflect.Bool:
+			a, aerr := strconv.ParseBool(value)
+			b, berr := strconv.ParseBool(r.value)
+			if aerr == nil && berr == nil {
+				return a == b
+			}
+		default:
+			if isNumeric(reflect.StructField{Type: r.condType}) {
+				a, b := reflect.New(r.condType).Elem(), reflect.New(r.condType).Elem()
+				if setChoice(a, value) == nil && setChoice(b, r.value) == nil {
+					return a.Interface() == b.Interface()
+				}
+			}
+		}
+	}
+	return value == r.value
+}
+
+// check returns an error listing the required environment variables
+// that were not resolved, if the rule's condition holds.
+func (r requiresRule) check(resolved map[string]string) error {
+	if missing := r.missing(resolved); len(missing) > 0 {
+		return fmt.Errorf("%s %s configuration was missing, required by %q", strings.Join(missing, ", "), configTypeEnvironment, r.raw)
+	}
+	return nil
+}
+
+// missing returns the required environment variables that were not
+// resolved, if the rule's condition holds.
+func (r requiresRule) missing(resolved map[string]string) (missing []string) {
+	value, ok := resolved[r.name]
+	if !ok || !r.holds(value) {
+		return nil
+	}
+
+	for _, name := range r.required {
+		if _, ok := resolved[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return
+}
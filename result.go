@@ -0,0 +1,84 @@
+package env
+
+// The sources recorded in a Result.
+const (
+	sourceEnvironment = "environment"
+	sourceDefault     = "default"
+	sourceCode        = "code"
+)
+
+// Result describes the outcome of a call to Apply.  More fields may
+// be added in future, so Results should only be created by Apply.
+type Result struct {
+	// Errors holds every error encountered while setting fields.
+	Errors []error
+
+	// Warnings holds every warning raised while setting fields.
+	Warnings []string
+
+	// Sources records where the value of each environment variable
+	// was taken from, keyed by the name of the variable.  The source
+	// is "environment", "default", the name of a Layer or, with
+	// WithCodeDefaults, "code".
+	// Variables that resolved to no value are not recorded.
+	Sources map[string]string
+
+	// Names records the name each environment variable's value was
+	// looked up under, which differs from its own name when it was
+	// found in a layer with a prefix.
+	Names map[string]string
+}
+
+// OK returns whether every field was set without error.
+func (r Result) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Apply sets the fields of a struct from environment config, as per
+// Set, but rather than stopping at the first error, it carries on
+// setting the remaining fields and returns a Result describing the
+// outcome.  Warnings are also passed to any handler provided with
+// WithWarningHandler.
+func Apply(i interface{}, opts ...Option) Result {
+	o := newOptions(opts)
+	r := &Result{Sources: map[string]string{}, Names: map[string]string{}}
+	o.result = r
+
+	handler := o.warnings
+	o.warnings = func(warning string) {
+		r.Warnings = append(r.Warnings, warning)
+		if handler != nil {
+			handler(warning)
+		}
+	}
+
+	if err := set(i, o); err != nil {
+		r.Errors = append(r.Errors, err)
+	}
+	return *r
+}
+
+// source records where the value of an environment variable was
+// taken from, if a result is being collected.  Values found in a
+// layer are recorded as coming from that layer.  It also notes that a
+// value was found in the environment, for processOneOf.
+func (o *options) source(key, source string) {
+	if source == sourceEnvironment && o.found != nil {
+		*o.found = true
+	}
+	if o.result == nil {
+		return
+	}
+
+	if source != sourceEnvironment {
+		o.result.Sources[key] = source
+		return
+	}
+
+	name := key
+	if hit, ok := o.layerHits[key]; ok {
+		source, name = hit.layer, hit.name
+	}
+	o.result.Sources[key] = source
+	o.result.Names[key] = name
+}
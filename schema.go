@@ -0,0 +1,247 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaValidator validates a JSON document.
+type SchemaValidator interface {
+	Validate(document []byte) error
+}
+
+// SchemaLoader returns the SchemaValidator referenced by the value
+// of a field's "jsonschema" tag.
+type SchemaLoader func(ref string) (SchemaValidator, error)
+
+// WithSchemaLoader overrides the SchemaLoader used to resolve the
+// "jsonschema" tag.  By default, the tag is treated as the path to a
+// schema file, which is compiled with CompileSchema.
+func WithSchemaLoader(l SchemaLoader) Option {
+	return func(o *options) {
+		o.schemaLoader = l
+	}
+}
+
+// FileSchemaLoader loads and compiles the schema at the given path.
+func FileSchemaLoader(ref string) (SchemaValidator, error) {
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return nil, err
+	}
+	return CompileSchema(b)
+}
+
+// MapSchemaLoader returns a SchemaLoader that compiles schemas held
+// in memory, keyed by reference.
+func MapSchemaLoader(schemas map[string]string) SchemaLoader {
+	return func(ref string) (SchemaValidator, error) {
+		s, ok := schemas[ref]
+		if !ok {
+			return nil, fmt.Errorf("schema %q not found", ref)
+		}
+		return CompileSchema([]byte(s))
+	}
+}
+
+// CompileSchema compiles a JSON Schema document into a validator.
+// Only a subset of JSON Schema is supported: type, enum, properties,
+// required, additionalProperties (as a Boolean), items, minimum,
+// maximum, minLength, maxLength, minItems and maxItems.
+func CompileSchema(schema []byte) (SchemaValidator, error) {
+	var s jsonSchema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &s, nil
+}
+
+// validateSchema validates the value of a field with a "jsonschema"
+// tag against the schema it references.
+func validateSchema(t reflect.StructField, value string, o *options) error {
+	ref, ok := t.Tag.Lookup("jsonschema")
+	if !ok {
+		return nil
+	}
+
+	key := o.key(t, t.Tag.Get("env"))
+	loader := o.schemaLoader
+	if loader == nil {
+		loader = FileSchemaLoader
+	}
+
+	validator, err := loader(ref)
+	if err != nil {
+		return fmt.Errorf("error loading schema %q for %s: %v", ref, key, err)
+	}
+
+	if err = validator.Validate([]byte(value)); err != nil {
+		// The validator's errors may quote any part of the value, so
+		// they are omitted entirely for secrets.
+		if isSecret(t) {
+			return fmt.Errorf("value of '%s' does not match schema %q", key, ref)
+		}
+		return fmt.Errorf("value of '%s' does not match schema %q: %v", key, ref, err)
+	}
+	return nil
+}
+
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+}
+
+// schemaTypes holds the value of the "type" keyword, which can be
+// either a single type or an array of types.
+type schemaTypes []string
+
+func (st *schemaTypes) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*st = schemaTypes{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*st = multiple
+	return nil
+}
+
+func (s *jsonSchema) Validate(document []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	var failures []string
+	s.validate(doc, "$", &failures)
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (s *jsonSchema) validate(doc interface{}, path string, failures *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*failures = append(*failures, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(doc) {
+		fail("expected %s", strings.Join(s.Type, " or "))
+		return
+	}
+
+	if len(s.Enum) > 0 && !containsValue(s.Enum, doc) {
+		fail("value is not one of the allowed values")
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := d[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				p.validate(d[k], path+"."+k, failures)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("unexpected property %q", k)
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(d) < *s.MinItems {
+			fail("expected at least %d items, got %d", *s.MinItems, len(d))
+		}
+		if s.MaxItems != nil && len(d) > *s.MaxItems {
+			fail("expected at most %d items, got %d", *s.MaxItems, len(d))
+		}
+		if s.Items != nil {
+			for i, item := range d {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), failures)
+			}
+		}
+	case string:
+		n := len([]rune(d))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("expected a length of at least %d, got %d", *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("expected a length of at most %d, got %d", *s.MaxLength, n)
+		}
+	case float64:
+		if s.Minimum != nil && d < *s.Minimum {
+			fail("expected a minimum of %v, got %v", *s.Minimum, d)
+		}
+		if s.Maximum != nil && d > *s.Maximum {
+			fail("expected a maximum of %v, got %v", *s.Maximum, d)
+		}
+	}
+}
+
+func (s *jsonSchema) matchesType(doc interface{}) bool {
+	for _, t := range s.Type {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && d == math.Trunc(d)) {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
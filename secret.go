@@ -0,0 +1,98 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redacted is the value shown in place of a secret when no custom
+// redactor has been provided.
+const redacted = "******"
+
+// WithSecretRedactor registers a function used to mask the values
+// of fields tagged with `secret:"true"` wherever they would otherwise
+// be rendered, such as in error messages.  By default, secret values
+// are masked entirely.
+func WithSecretRedactor(r func(value string) string) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// isSecret returns true if the field has been tagged as a secret.
+// An unparsable secret tag is treated as a secret, so a typo never
+// results in a secret being exposed.
+func isSecret(t reflect.StructField) bool {
+	tag, ok := t.Tag.Lookup("secret")
+	if !ok {
+		return false
+	}
+
+	b, err := strconv.ParseBool(tag)
+	return err != nil || b
+}
+
+// redact returns the value to render for the field, masking it if
+// the field has been tagged as a secret.  This is the only place a
+// secret value is handed to the redactor.
+func redact(t reflect.StructField, value string, o *options) string {
+	if !isSecret(t) {
+		return value
+	}
+	if o.redactor != nil {
+		return o.redactor(value)
+	}
+	return redacted
+}
+
+// checkMinLen returns an error if the value is shorter than the
+// number of bytes given by the field's "minlen" tag.  The error only
+// reports the length of the value, so is safe for secret fields such
+// as signing keys.
+func checkMinLen(t reflect.StructField, value string, o *options) error {
+	minTag, ok := t.Tag.Lookup("minlen")
+	if !ok {
+		return nil
+	}
+
+	min, err := strconv.Atoi(minTag)
+	if err != nil || min < 0 {
+		return fmt.Errorf("invalid minlen tag %q: expected a non-negative integer", minTag)
+	}
+
+	if len(value) < min {
+		return fmt.Errorf("%s must be at least %d bytes, got %d", o.key(t, t.Tag.Get("env")), min, len(value))
+	}
+	return nil
+}
+
+// redactElements masks each of the given elements of a secret field's
+// value wherever they appear in the error, for errors raised while
+// parsing part of the value, such as an element of a slice, which the
+// whole value won't match.
+func redactElements(t reflect.StructField, err error, o *options, elements ...string) error {
+	if err == nil || !isSecret(t) {
+		return err
+	}
+	// Mask longer elements first, so that an element contained in
+	// another doesn't leave the rest of the other exposed.
+	sorted := append([]string(nil), elements...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, element := range sorted {
+		err = redactError(err, element, redact(t, element, o))
+	}
+	return err
+}
+
+// redactError replaces any occurrence of a secret value in the error
+// message with its redacted form.
+func redactError(err error, value string, masked string) error {
+	if len(value) == 0 || !strings.Contains(err.Error(), value) {
+		return err
+	}
+	return errors.New(strings.Replace(err.Error(), value, masked, -1))
+}
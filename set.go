@@ -1,17 +1,42 @@
 package env
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 var (
-	binaryType = reflect.TypeOf([]uint8{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	interfaceType = reflect.TypeOf(&net.Interface{})
+	monthType     = reflect.TypeOf(time.Month(0))
+	timeType      = reflect.TypeOf(time.Time{})
+	urlType       = reflect.TypeOf(&url.URL{})
+	weekdayType   = reflect.TypeOf(time.Weekday(0))
 )
 
+// durationStrategies are the conversions that can be attempted, in
+// order, for a time.Duration field with a "try" tag.
+var durationStrategies = map[string]func(string) (time.Duration, error){
+	"clock":    parseClock,
+	"duration": time.ParseDuration,
+	"int": func(value string) (time.Duration, error) {
+		i, err := strconv.ParseInt(value, 10, 64)
+		return time.Duration(i) * time.Second, err
+	},
+	"float": func(value string) (time.Duration, error) {
+		f, err := strconv.ParseFloat(value, 64)
+		return time.Duration(f * float64(time.Second)), err
+	},
+}
+
 // setField determines a field's type and parses the given value
 // accordingly.  An error will be returned if the field is unexported.
 func setBuiltInField(fieldValue reflect.Value, value string) (err error) {
@@ -42,7 +67,7 @@ func setBool(fieldValue reflect.Value, value string) (err error) {
 }
 
 func setInt(fieldValue reflect.Value, value string) (err error) {
-	if fieldValue.Type() == reflect.TypeOf((*time.Duration)(nil)).Elem() {
+	if fieldValue.Type() == durationType {
 		return setDuration(fieldValue, value)
 	}
 
@@ -85,38 +110,260 @@ func setDuration(fieldValue reflect.Value, value string) (err error) {
 	return
 }
 
+// setTry attempts each of the comma-separated conversion strategies
+// in turn, using the first that succeeds.  Numeric strategies are
+// interpreted as a number of seconds.
+func setTry(fieldValue reflect.Value, value string, strategies string) (err error) {
+	if fieldValue.Type() != durationType {
+		return fmt.Errorf("try tag is not supported for %v", fieldValue.Type())
+	}
+
+	names := split(strategies, ",")
+	for _, name := range names {
+		parse, ok := durationStrategies[name]
+		if !ok {
+			return fmt.Errorf("invalid try tag %q: unknown strategy %q", strategies, name)
+		}
+
+		var d time.Duration
+		if d, err = parse(value); err == nil {
+			fieldValue.SetInt(int64(d))
+			return
+		}
+	}
+
+	return fmt.Errorf("value could not be parsed using any of %s", strings.Join(names, ", "))
+}
+
+// stripGroupSeparators removes the "_" and "," characters used to
+// group digits, such as in "1,000" or "1_000", from the value of a
+// numeric field tagged `group_sep:"true"`.  The tag is only valid for
+// scalar fields, so commas are never mistaken for slice delimiters.
+func stripGroupSeparators(t reflect.StructField, v reflect.Value, value string) (string, error) {
+	groupSep, err := boolTag(t, "group_sep")
+	if err != nil || !groupSep {
+		return value, err
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return "", fmt.Errorf("group_sep tag is not supported for %v", v.Type())
+	}
+	if v.Type() == durationType {
+		return "", fmt.Errorf("group_sep tag is not supported for %v", v.Type())
+	}
+
+	return strings.NewReplacer("_", "", ",", "").Replace(value), nil
+}
+
 func setString(fieldValue reflect.Value, value string) (err error) {
 	fieldValue.SetString(value)
 	return
 }
 
-func setSlice(t reflect.StructField, v reflect.Value, value string) (err error) {
-	// []uint8 and []byte are special cases, as they can be used to store
-	// binary data, which we'll favour over storing comma-separated uint8s.
-	if t.Type == binaryType {
-		v.SetBytes([]byte(value))
+func setInterface(fieldValue reflect.Value, value string) (err error) {
+	var iface *net.Interface
+	if iface, err = net.InterfaceByName(value); err != nil {
+		return fmt.Errorf("network interface %q not found on host: %v", value, err)
+	}
+
+	fieldValue.Set(reflect.ValueOf(iface))
+	return
+}
+
+func setTime(fieldValue reflect.Value, value string, layout string) (err error) {
+	var tm time.Time
+	if tm, err = time.Parse(layout, value); err != nil {
+		return err
+	}
+
+	fieldValue.Set(reflect.ValueOf(tm))
+	return
+}
+
+func setTimeSlice(t reflect.StructField, v reflect.Value, rawValues []string, o *options) (err error) {
+	layout := getLayout(t)
+
+	sliceValue := reflect.MakeSlice(v.Type(), len(rawValues), len(rawValues))
+	for i, item := range rawValues {
+		if err = setTime(sliceValue.Index(i), item, layout); err != nil {
+			return fmt.Errorf("error setting %q: element %d (%q) does not match layout %q", t.Name, i, redact(t, item, o), layout)
+		}
+	}
+
+	if err = sortSlice(t, sliceValue); err != nil {
+		return
+	}
+	v.Set(sliceValue)
+	return
+}
+
+func setURL(fieldValue reflect.Value, value string) (err error) {
+	var u *url.URL
+	if u, err = url.Parse(value); err != nil {
+		return err
+	}
+
+	fieldValue.Set(reflect.ValueOf(u))
+	return
+}
+
+// checkScheme returns an error if a URL's scheme is not one of those
+// given by the field's "schemes" tag.
+func checkScheme(t reflect.StructField, v reflect.Value, o *options) error {
+	schemes, ok := t.Tag.Lookup("schemes")
+	if !ok {
+		return nil
+	}
+
+	scheme := v.Interface().(*url.URL).Scheme
+	for _, s := range strings.Split(schemes, ",") {
+		if strings.EqualFold(strings.TrimSpace(s), scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("value of '%s' has scheme '%s', but must be one of '%s'", o.key(t, t.Tag.Get("env")), scheme, schemes)
+}
+
+func setSlice(t reflect.StructField, v reflect.Value, value string, o *options) (err error) {
+	// Binary data and structs have no natural order.
+	if _, ok := t.Tag.Lookup("sort"); ok && t.Type.Elem() != timeType {
+		if k := t.Type.Elem().Kind(); k == reflect.Uint8 || k == reflect.Struct {
+			return fmt.Errorf("sort tag is not supported for %v", t.Type)
+		}
+	}
+
+	// []uint8 and []byte (and named types such as json.RawMessage) are
+	// special cases, as they can be used to store binary data, which
+	// we'll favour over storing comma-separated uint8s.
+	if t.Type.Elem().Kind() == reflect.Uint8 {
+		var b []byte
+		if b, err = decodeBytes(t, value, o); err != nil {
+			return
+		}
+		v.SetBytes(b)
 		return
 	}
 
 	// Allow the user to provide their own delimiter, falling back to a
 	// comma if one isn't provided.
-	delimiter := getDelimiter(t)
+	delimiter := getDelimiter(t, o)
 	rawValues := split(value, delimiter)
 	if len(rawValues) == 0 {
 		return
 	}
 
+	if err = checkJoinedBytes(t, rawValues, delimiter, o); err != nil {
+		return
+	}
+
+	if err = checkElementPatterns(t, rawValues, o); err != nil {
+		return
+	}
+
+	if t.Type.Elem() == timeType {
+		return setTimeSlice(t, v, rawValues, o)
+	}
+
+	// Slices of structs are populated from compound elements.
+	if t.Type.Elem().Kind() == reflect.Struct {
+		return setStructSlice(t, v, rawValues, o)
+	}
+
 	sliceValue, err := makeSlice(v, len(rawValues))
 	if err != nil {
 		return
 	}
 
-	populateSlice(sliceValue, rawValues)
+	populateSlice(sliceValue, rawValues, o)
+	if err = sortSlice(t, sliceValue); err != nil {
+		return
+	}
 	v.Set(sliceValue)
 
 	return
 }
 
+// decodeBytes decodes the value of a []byte field according to its
+// "encoding" tag, which is either "hex" or "base64", and validates the
+// decoded length against its "len" tag.  Errors never include the
+// value, as such fields often hold cryptographic material.
+func decodeBytes(t reflect.StructField, value string, o *options) (b []byte, err error) {
+	key := o.key(t, t.Tag.Get("env"))
+
+	switch encoding := t.Tag.Get("encoding"); encoding {
+	case "":
+		b = []byte(value)
+	case "hex":
+		if b, err = hex.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("%s is not valid hex", key)
+		}
+	case "base64":
+		if b, err = base64.StdEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("%s is not valid base64", key)
+		}
+	default:
+		return nil, fmt.Errorf("invalid encoding tag %q: expected 'hex' or 'base64'", encoding)
+	}
+
+	if lenTag, ok := t.Tag.Lookup("len"); ok {
+		n, err := strconv.Atoi(lenTag)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid len tag %q: expected a non-negative integer", lenTag)
+		}
+		if len(b) != n {
+			return nil, fmt.Errorf("%s must be %d bytes, got %d", key, n, len(b))
+		}
+	}
+	return b, nil
+}
+
+// checkJoinedBytes returns an error if the elements of a slice,
+// re-joined with the delimiter, exceed the length given by the
+// "maxjoinedbytes" tag.
+func checkJoinedBytes(t reflect.StructField, rawValues []string, delimiter string, o *options) error {
+	maxTag, ok := t.Tag.Lookup("maxjoinedbytes")
+	if !ok {
+		return nil
+	}
+
+	max, err := strconv.Atoi(maxTag)
+	if err != nil || max < 0 {
+		return fmt.Errorf("invalid maxjoinedbytes tag %q: expected a non-negative integer", maxTag)
+	}
+
+	if n := len(strings.Join(rawValues, delimiter)); n > max {
+		return fmt.Errorf("%s is %d bytes when joined, exceeding the maximum of %d", o.key(t, t.Tag.Get("env")), n, max)
+	}
+	return nil
+}
+
+// checkUnique returns an error naming the first repeated element of a
+// slice field tagged with `unique:"true"`.  Duplicates are reported
+// rather than removed, as they usually indicate a mistake.
+func checkUnique(t reflect.StructField, v reflect.Value, o *options) error {
+	unique, err := boolTag(t, "unique")
+	if err != nil || !unique {
+		return err
+	}
+	if !v.Type().Elem().Comparable() {
+		return fmt.Errorf("unique tag is not supported for %v", v.Type())
+	}
+
+	seen := make(map[interface{}]bool, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i).Interface()
+		if seen[e] {
+			return fmt.Errorf("value of '%s' contains '%s' more than once", o.key(t, t.Tag.Get("env")), redact(t, fmt.Sprint(e), o))
+		}
+		seen[e] = true
+	}
+	return nil
+}
+
 func makeSlice(v reflect.Value, n int) (slice reflect.Value, err error) {
 	switch v.Type() {
 	case reflect.TypeOf([]string{}):
@@ -153,10 +400,108 @@ func makeSlice(v reflect.Value, n int) (slice reflect.Value, err error) {
 	return
 }
 
-func populateSlice(sliceValue reflect.Value, rawItems []string) {
+func populateSlice(sliceValue reflect.Value, rawItems []string, o *options) {
 	for i, item := range rawItems {
-		setBuiltInField(sliceValue.Index(i), item)
+		o.setBuiltInField(sliceValue.Index(i), item)
+	}
+}
+
+// isSet returns true if the given type is a map with an empty struct
+// value, which is idiomatically used as a set in Go.
+func isSet(t reflect.Type) bool {
+	return t.Kind() == reflect.Map &&
+		t.Elem().Kind() == reflect.Struct &&
+		t.Elem().NumField() == 0
+}
+
+func setSet(t reflect.StructField, v reflect.Value, value string, o *options) (err error) {
+	rawValues := split(value, getDelimiter(t, o))
+	if err = checkElementPatterns(t, rawValues, o); err != nil {
+		return
+	}
+
+	set := reflect.MakeMapWithSize(v.Type(), len(rawValues))
+	member := reflect.New(v.Type().Elem()).Elem()
+	for _, item := range rawValues {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err = setBuiltInField(key, item); err != nil {
+			return redactElements(t, fmt.Errorf("error setting %q: %v", t.Name, err), o, item)
+		}
+		set.SetMapIndex(key, member)
+	}
+
+	v.Set(set)
+	return
+}
+
+// sortSlice sorts the slice in the order given by the field's "sort"
+// tag, which can be either "asc" or "desc".  Times are sorted
+// chronologically.
+func sortSlice(t reflect.StructField, sliceValue reflect.Value) error {
+	order, ok := t.Tag.Lookup("sort")
+	if !ok {
+		return nil
+	}
+	if order != "asc" && order != "desc" {
+		return fmt.Errorf("invalid sort tag %q: expected 'asc' or 'desc'", order)
+	}
+
+	var less func(i, j int) bool
+	switch sliceValue.Type().Elem().Kind() {
+	case reflect.String:
+		less = func(i, j int) bool { return sliceValue.Index(i).String() < sliceValue.Index(j).String() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(i, j int) bool { return sliceValue.Index(i).Int() < sliceValue.Index(j).Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		less = func(i, j int) bool { return sliceValue.Index(i).Uint() < sliceValue.Index(j).Uint() }
+	case reflect.Float32, reflect.Float64:
+		less = func(i, j int) bool { return sliceValue.Index(i).Float() < sliceValue.Index(j).Float() }
+	default:
+		if sliceValue.Type().Elem() != timeType {
+			return fmt.Errorf("sort tag is not supported for %v", sliceValue.Type())
+		}
+		less = func(i, j int) bool {
+			return sliceValue.Index(i).Interface().(time.Time).Before(sliceValue.Index(j).Interface().(time.Time))
+		}
+	}
+
+	if order == "desc" {
+		asc := less
+		less = func(i, j int) bool { return asc(j, i) }
 	}
+
+	sort.SliceStable(sliceValue.Interface(), less)
+	return nil
+}
+
+// unquote removes a single pair of matching double or single quotes
+// surrounding the value, if present.
+func unquote(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if first == last && (first == '"' || first == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// unquoteValue unquotes the value and, if the field holds multiple
+// values, each of its elements.
+func unquoteValue(t reflect.StructField, value string, o *options) string {
+	value = unquote(value)
+
+	multiple := isSet(t.Type) || (t.Type.Kind() == reflect.Slice && t.Type.Elem().Kind() != reflect.Uint8)
+	if !multiple {
+		return value
+	}
+
+	delimiter := getDelimiter(t, o)
+	elements := split(value, delimiter)
+	for i, e := range elements {
+		elements[i] = unquote(e)
+	}
+	return strings.Join(elements, delimiter)
 }
 
 func split(value string, delimeter string) []string {
@@ -173,9 +518,45 @@ func split(value string, delimeter string) []string {
 	return out
 }
 
-func getDelimiter(t reflect.StructField) string {
+// delimiterTokens are names that can be given in a "delimiter" tag
+// for characters that are awkward to express in a struct tag.
+var delimiterTokens = map[string]string{
+	"newline": "\n",
+	"tab":     "\t",
+	"space":   " ",
+}
+
+// getDelimiter returns the delimiter for the field's values, which
+// is given by its "delimiter" tag.  Otherwise, slice and set fields
+// use the delimiter given to WithStructDelimiter, if any, and all
+// other fields use a comma.  The options may be nil.
+func getDelimiter(t reflect.StructField, o *options) string {
 	if d, ok := t.Tag.Lookup("delimiter"); ok {
+		if token, ok := delimiterTokens[d]; ok {
+			return token
+		}
 		return d
 	}
+	if o != nil && o.structDelimiter != "" && splitsValue(t) {
+		return o.structDelimiter
+	}
 	return ","
 }
+
+// splitsValue returns whether the field's value is split into
+// elements, so that the struct delimiter applies to it.
+func splitsValue(t reflect.StructField) bool {
+	if t.Type.Kind() == reflect.Slice || isSet(t.Type) || isHeadTail(t) {
+		return true
+	}
+	return t.Type.Implements(tagSetterType) || reflect.PtrTo(t.Type).Implements(tagSetterType)
+}
+
+// getLayout returns the layout used to parse time.Time fields,
+// falling back to RFC 3339 if no "layout" tag is provided.
+func getLayout(t reflect.StructField) string {
+	if l, ok := t.Tag.Lookup("layout"); ok {
+		return l
+	}
+	return time.RFC3339
+}
@@ -0,0 +1,53 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"unicode"
+)
+
+// FieldSpec describes a field to be set by SetInto, for configuration
+// that is only known at runtime.
+type FieldSpec struct {
+	// Name is the key of the value in the result, which must be a
+	// valid exported Go identifier, such as "Port".
+	Name string
+
+	// Type is the type of the value, such as reflect.TypeOf(0).
+	Type reflect.Type
+
+	// Tag holds the field's tags, such as `env:"PORT" default:"80"`.
+	Tag reflect.StructTag
+}
+
+// SetInto sets a value for each of the given field specs, just as the
+// fields of a struct are set by Set, returning the values keyed by
+// the name of each spec.
+func SetInto(spec []FieldSpec, opts ...Option) (map[string]interface{}, error) {
+	fields := make([]reflect.StructField, len(spec))
+	seen := map[string]bool{}
+	for i, s := range spec {
+		if s.Name == "" || !unicode.IsUpper([]rune(s.Name)[0]) || ident(s.Name) != s.Name {
+			return nil, fmt.Errorf("invalid field spec name %q: expected an exported identifier", s.Name)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("invalid field spec name %q: duplicate name", s.Name)
+		}
+		if s.Type == nil {
+			return nil, fmt.Errorf("invalid field spec %q: missing type", s.Name)
+		}
+		seen[s.Name] = true
+		fields[i] = reflect.StructField{Name: s.Name, Type: s.Type, Tag: s.Tag}
+	}
+
+	v := reflect.New(reflect.StructOf(fields))
+	if err := Set(v.Interface(), opts...); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(spec))
+	for _, s := range spec {
+		values[s.Name] = v.Elem().FieldByName(s.Name).Interface()
+	}
+	return values, nil
+}
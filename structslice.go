@@ -0,0 +1,96 @@
+package env
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// setStructSlice populates a slice of structs, splitting each of the
+// raw values into the fields of a struct according to the field's
+// tags.
+func setStructSlice(t reflect.StructField, v reflect.Value, rawValues []string, o *options) (err error) {
+	var splitter func(string) ([]string, error)
+
+	if b, _ := strconv.ParseBool(t.Tag.Get("weighted")); b {
+		splitter = splitWeighted
+	} else if b, _ := strconv.ParseBool(t.Tag.Get("hostport")); b {
+		splitter = splitHostPort
+	} else {
+		return fmt.Errorf("%v is not supported", v.Type())
+	}
+
+	sliceValue := reflect.MakeSlice(v.Type(), len(rawValues), len(rawValues))
+	for i, item := range rawValues {
+		var parts []string
+		if parts, err = splitter(item); err != nil {
+			return redactElements(t, fmt.Errorf("error setting %q: element %d: %v", t.Name, i, err), o, item)
+		}
+
+		if err = setStructFields(sliceValue.Index(i), parts); err != nil {
+			return redactElements(t, fmt.Errorf("error setting %q: element %d: %v", t.Name, i, err), o, append(parts, item)...)
+		}
+	}
+
+	v.Set(sliceValue)
+	return
+}
+
+// exportedFields returns the number of exported fields in a struct.
+func exportedFields(structValue reflect.Value) (n int) {
+	for i := 0; i < structValue.NumField(); i++ {
+		if structValue.Field(i).CanSet() {
+			n++
+		}
+	}
+	return
+}
+
+// setStructFields sets the exported fields of a struct, in order
+// of declaration, to each of the given values.
+func setStructFields(structValue reflect.Value, values []string) (err error) {
+	var fields []reflect.Value
+	for i := 0; i < structValue.NumField(); i++ {
+		if structValue.Field(i).CanSet() {
+			fields = append(fields, structValue.Field(i))
+		}
+	}
+
+	if len(fields) < len(values) {
+		return fmt.Errorf("%v has %d exported fields, but %d values are required", structValue.Type(), len(fields), len(values))
+	}
+
+	for i, value := range values {
+		if err = setBuiltInField(fields[i], value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// splitWeighted splits a "value:weight" pair, validating that the
+// weight is an integer.
+func splitWeighted(item string) ([]string, error) {
+	i := strings.LastIndex(item, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("%q is missing a weight", item)
+	}
+
+	value, weight := item[:i], item[i+1:]
+	if _, err := strconv.Atoi(weight); err != nil {
+		return nil, fmt.Errorf("%q has a non-numeric weight", item)
+	}
+	return []string{value, weight}, nil
+}
+
+// splitHostPort splits a "host:port" pair, as per net.SplitHostPort,
+// so IPv6 hosts must be enclosed in square brackets.
+func splitHostPort(item string) ([]string, error) {
+	host, port, err := net.SplitHostPort(item)
+	if err != nil {
+		return nil, err
+	}
+	return []string{host, port}, nil
+}
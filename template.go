@@ -0,0 +1,111 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"text/template"
+)
+
+// maxTemplatePasses caps the number of times template fields are
+// rendered, to prevent template fields that reference one another
+// from rendering forever.
+const maxTemplatePasses = 10
+
+type pendingTemplate struct {
+	field    reflect.StructField
+	value    reflect.Value
+	text     string
+	rendered string
+}
+
+// templateData is the data made available to template fields.  Env
+// holds the environment and Fields holds the exported fields of the
+// struct being set, keyed by field name.
+type templateData struct {
+	Env    map[string]string
+	Fields map[string]interface{}
+}
+
+// renderTemplates renders the templates of any deferred template
+// fields.  As template fields can reference one another, rendering
+// is repeated until the output of every template is stable.
+func renderTemplates(v reflect.Value, o *options) (err error) {
+	if len(o.templates) == 0 {
+		return
+	}
+
+	data := templateData{}
+	if data.Env, err = o.templateEnv(); err != nil {
+		return
+	}
+
+	for pass := 0; pass < maxTemplatePasses; pass++ {
+		data.Fields = fields(v)
+
+		changed := false
+		for i := range o.templates {
+			p := &o.templates[i]
+
+			var rendered string
+			if rendered, err = render(p.text, data); err != nil {
+				return fmt.Errorf("error rendering template for %q: %v", p.field.Name, err)
+			}
+			if pass > 0 && rendered == p.rendered {
+				continue
+			}
+
+			changed = true
+			p.rendered = rendered
+			if err = setField(p.field, p.value, rendered, o); err != nil {
+				return
+			}
+		}
+
+		if !changed {
+			return
+		}
+	}
+
+	return fmt.Errorf("template fields did not resolve after %d passes", maxTemplatePasses)
+}
+
+func render(text string, data templateData) (string, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateEnv returns the values available to templates as Env,
+// which are looked up in the same way as the values of fields, so
+// that templates can't see keys that have not been allowed.
+func (o *options) templateEnv() (map[string]string, error) {
+	env := map[string]string{}
+	for _, name := range o.environ() {
+		value, ok, err := o.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			env[name] = value
+		}
+	}
+	return env, nil
+}
+
+func fields(v reflect.Value) map[string]interface{} {
+	f := map[string]interface{}{}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).CanInterface() {
+			f[v.Type().Field(i).Name] = v.Field(i).Interface()
+		}
+	}
+	return f
+}
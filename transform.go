@@ -0,0 +1,115 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// transforms are the functions that can be named in a "transform"
+// tag, which are applied to a value before it is converted.
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]func(context.Context, string) (string, error){
+		"lower": func(_ context.Context, s string) (string, error) { return strings.ToLower(s), nil },
+		"upper": func(_ context.Context, s string) (string, error) { return strings.ToUpper(s), nil },
+		"trim":  func(_ context.Context, s string) (string, error) { return strings.TrimSpace(s), nil },
+		"ident": func(_ context.Context, s string) (string, error) { return ident(s), nil },
+	}
+)
+
+// RegisterTransform registers a function that can be named in a
+// "transform" tag, such as `transform:"b64d,trim"`, replacing any
+// transform already registered with the same name, including the
+// built-in lower, upper, trim and ident transforms.
+func RegisterTransform(name string, f func(string) (string, error)) {
+	RegisterTransformContext(name, func(_ context.Context, s string) (string, error) {
+		return f(s)
+	})
+}
+
+// RegisterTransformContext registers a transform as per
+// RegisterTransform, for transforms that may block, such as those
+// that call a remote service.  The function is called with the
+// context given to SetCtx, or context.Background() otherwise.
+func RegisterTransformContext(name string, f func(ctx context.Context, s string) (string, error)) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[name] = f
+}
+
+// transform applies each of the comma-separated transforms named by
+// the field's "transform" tag to the value, in order.
+func transform(t reflect.StructField, value string, o *options) (string, error) {
+	tag, ok := t.Tag.Lookup("transform")
+	if !ok {
+		return value, nil
+	}
+
+	for _, name := range strings.Split(tag, ",") {
+		f, err := lookupTransform(tag, name)
+		if err != nil {
+			return "", err
+		}
+
+		if value, err = f(o.ctx, value); err != nil {
+			return "", fmt.Errorf("error transforming %q: %v", t.Name, err)
+		}
+	}
+	return value, nil
+}
+
+// checkTransforms returns an error if the field's "transform" tag
+// names a transform that hasn't been registered, so that the tag is
+// rejected even when there is no value to transform.
+func checkTransforms(t reflect.StructField) error {
+	tag, ok := t.Tag.Lookup("transform")
+	if !ok {
+		return nil
+	}
+
+	for _, name := range strings.Split(tag, ",") {
+		if _, err := lookupTransform(tag, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lookupTransform(tag string, name string) (func(context.Context, string) (string, error), error) {
+	transformsMu.RLock()
+	f, ok := transforms[strings.TrimSpace(name)]
+	transformsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("invalid transform tag %q: unknown transform %q", tag, name)
+	}
+	return f, nil
+}
+
+// ident converts a value into a valid Go identifier.  Each run of
+// characters that are not letters, digits or underscores is replaced
+// with a single underscore, leading and trailing underscores are
+// removed and, if the result begins with a digit, it is prefixed
+// with an underscore.  So "my service!" becomes "my_service".
+func ident(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range s {
+		if r != '_' && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore {
+			b.WriteRune('_')
+			underscore = true
+		}
+	}
+
+	id := strings.Trim(b.String(), "_")
+	if id != "" && unicode.IsDigit([]rune(id)[0]) {
+		id = "_" + id
+	}
+	return id
+}
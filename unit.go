@@ -0,0 +1,73 @@
+package env
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+var (
+	unitsMu sync.RWMutex
+	units   = map[string]func(string) (float64, error){}
+)
+
+// RegisterUnit registers a function that parses values expressed in
+// the named unit, for fields tagged with the unit, such as
+// `unit:"rpm"`.  The function is given the whole value, so it can
+// handle suffixes and scaling as required.
+func RegisterUnit(name string, parse func(string) (float64, error)) {
+	unitsMu.Lock()
+	defer unitsMu.Unlock()
+	units[name] = parse
+}
+
+// checkUnit returns an error if the field's "unit" tag names a unit
+// that hasn't been registered, so that the tag is rejected even when
+// there is no value to parse.
+func checkUnit(t reflect.StructField) error {
+	unit, ok := t.Tag.Lookup("unit")
+	if !ok {
+		return nil
+	}
+
+	unitsMu.RLock()
+	_, ok = units[unit]
+	unitsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("error setting %q: invalid unit tag %q: unknown unit", t.Name, unit)
+	}
+	return nil
+}
+
+// setUnit sets a float or integer field from a value parsed by the
+// registered unit.  Integer fields only accept whole numbers.
+func setUnit(v reflect.Value, value string, unit string) error {
+	unitsMu.RLock()
+	parse, ok := units[unit]
+	unitsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("invalid unit tag %q: unknown unit", unit)
+	}
+
+	f, err := parse(value)
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) {
+			return fmt.Errorf("%v %s overflows %v", f, unit, v.Type())
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) || v.OverflowInt(int64(f)) {
+			return fmt.Errorf("%v %s is not a valid %v", f, unit, v.Type())
+		}
+		v.SetInt(int64(f))
+	default:
+		return fmt.Errorf("unit tag is not supported for %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// processWildcard sets a slice of structs from every environment
+// variable matching an "env" tag containing a single "*" wildcard,
+// such as "WORKER_*_CONCURRENCY".  For each match, the text captured
+// by the wildcard is set to the struct's Name field and the value is
+// set to the struct's first other exported field.  Elements are
+// ordered by the captured name.
+//
+// Returns false if the tag has no wildcard, or if no environment
+// variables matched.
+func processWildcard(t reflect.StructField, v reflect.Value, key string, o *options) (found bool, err error) {
+	if !strings.Contains(key, "*") {
+		return
+	}
+	if strings.Count(key, "*") > 1 {
+		return false, fmt.Errorf("env tag %q must contain a single wildcard", key)
+	}
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return false, fmt.Errorf("wildcard env tag is not supported for %v", v.Type())
+	}
+
+	elemType := v.Type().Elem()
+	nameField, ok := elemType.FieldByName("Name")
+	if !ok || nameField.Type.Kind() != reflect.String {
+		return false, fmt.Errorf("%v must have a Name string field to use a wildcard env tag", elemType)
+	}
+	valueIndex := -1
+	for i := 0; i < elemType.NumField(); i++ {
+		if f := elemType.Field(i); f.PkgPath == "" && f.Name != "Name" {
+			valueIndex = i
+			break
+		}
+	}
+	if valueIndex < 0 {
+		return false, fmt.Errorf("%v must have an exported field other than Name to use a wildcard env tag", elemType)
+	}
+
+	names, matches := matchWildcard(key, o)
+	if len(names) == 0 {
+		return
+	}
+	if o.presenceOnly {
+		o.resolved[t.Tag.Get("env")] = strings.Join(names, ",")
+		return true, nil
+	}
+
+	sliceValue := reflect.MakeSlice(v.Type(), len(names), len(names))
+	for i, name := range names {
+		value, _, lerr := o.lookup(matches[name])
+		if lerr != nil {
+			return false, lerr
+		}
+
+		elem := sliceValue.Index(i)
+		elem.FieldByIndex(nameField.Index).SetString(name)
+		if err = setBuiltInField(elem.Field(valueIndex), value); err != nil {
+			return false, redactElements(t, fmt.Errorf("error setting %q: %s: %v", t.Name, matches[name], err), o, value)
+		}
+	}
+
+	v.Set(sliceValue)
+	o.resolved[t.Tag.Get("env")] = strings.Join(names, ",")
+	return true, nil
+}
+
+// matchWildcard returns the text captured by the single "*" wildcard
+// in the key for each matching environment variable, in sorted order,
+// along with the name of the variable each capture was matched from.
+func matchWildcard(key string, o *options) (names []string, matches map[string]string) {
+	parts := strings.SplitN(key, "*", 2)
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(parts[0]) + "(.+)" + regexp.QuoteMeta(parts[1]) + "$")
+
+	matches = map[string]string{}
+	for _, envName := range o.environ() {
+		if m := pattern.FindStringSubmatch(envName); m != nil {
+			matches[m[1]] = envName
+			names = append(names, m[1])
+		}
+	}
+	sort.Strings(names)
+	return
+}